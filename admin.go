@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Admin commands ------------------------
+// /ban <user_id> и /unban <user_id> доступны пользователям из ADMIN_IDS.
+// Заблокированный не может сохранять профиль, создавать анкеты и жаловаться
+// (хранилище возвращает ErrBanned), его профиль скрыт из поиска и рассылки,
+// а активная анкета закрывается при блокировке.
+
+func isAdmin(userID int64) bool {
+	for _, id := range adminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func handleBanCommand(ctx context.Context, b *Bot, msg *tgbot.Message, lang string) {
+	ban := msg.Command() == "ban"
+	target, err := strconv.ParseInt(strings.TrimSpace(msg.CommandArguments()), 10, 64)
+	if err != nil {
+		sendText(b, msg.Chat.ID, T(lang, "admin.ban_usage"))
+		return
+	}
+	if err := storage.SetUserBanned(ctx, target, ban); err != nil {
+		sendText(b, msg.Chat.ID, T(lang, errorKey(ctx, err, "")))
+		return
+	}
+	logger(ctx).Info("user ban changed", slog.Int64("target", target), slog.Bool("banned", ban))
+	if !ban {
+		sendText(b, msg.Chat.ID, T(lang, "admin.unbanned", target))
+		return
+	}
+	if err := deleteOrderByCreator(ctx, target); err != nil && !errors.Is(err, ErrNotFound) {
+		logger(ctx).Error("close banned user's order", slog.Int64("target", target), slog.Any("err", err))
+	}
+	sendText(b, msg.Chat.ID, T(lang, "admin.banned", target))
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
+	"log/slog"
+
 	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"log"
 )
 
 type Bot struct {
@@ -12,11 +13,11 @@ type Bot struct {
 // InitBot инициализирует бота с токеном
 func InitBot(token string) *Bot {
 	if token == "" {
-		log.Fatal("TELEGRAM_BOT_TOKEN is required")
+		fatal("TELEGRAM_BOT_TOKEN is required")
 	}
 	api, err := tgbot.NewBotAPI(token)
 	if err != nil {
-		log.Fatalf("new bot api: %v", err)
+		fatal("new bot api", slog.Any("err", err))
 	}
 	api.Debug = false
 	return &Bot{api: api}
@@ -27,20 +28,27 @@ func (b *Bot) Shutdown() {
 	// nothing for now
 }
 
-// Send отправляет любое сообщение в Telegram
-func (b *Bot) Send(msg tgbot.Chattable) {
-	_, err := b.api.Send(msg)
-	if err != nil {
-		log.Printf("send error: %v", err)
+// SetWebhook устанавливает вебхук для бота; secretToken Telegram будет
+// присылать в заголовке X-Telegram-Bot-Api-Secret-Token
+func (b *Bot) SetWebhook(url, secretToken string) error {
+	// WebhookConfig в tgbot v5.5 не знает secret_token, поэтому параметры собираются вручную
+	params := tgbot.Params{"url": url}
+	params.AddNonEmpty("secret_token", secretToken)
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
 	}
+	_, err := b.api.MakeRequest("setWebhook", params)
+	return err
 }
 
-// SetWebhook устанавливает вебхук для бота
-func (b *Bot) SetWebhook(url string) error {
-	webhookConfig, err := tgbot.NewWebhook(url)
-	if err != nil {
-		return err
-	}
-	_, err = b.api.Request(webhookConfig)
+// DeleteWebhook снимает вебхук, чтобы можно было получать апдейты через getUpdates;
+// dropPending отбрасывает накопленные в Telegram апдейты
+func (b *Bot) DeleteWebhook(dropPending bool) error {
+	_, err := b.api.Request(tgbot.DeleteWebhookConfig{DropPendingUpdates: dropPending})
 	return err
 }
+
+// WebhookInfo возвращает состояние вебхука из getWebhookInfo
+func (b *Bot) WebhookInfo() (tgbot.WebhookInfo, error) {
+	return b.api.GetWebhookInfo()
+}
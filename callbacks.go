@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Callback router ------------------------
+// Формат callback data (версия 1):
+//
+//	1|<route>|<arg>|<arg>...[|<sig>]
+//
+// Числа кодируются в base36, строки передаются как есть (без "|").
+// Для подписанных маршрутов последним полем идёт усечённый HMAC-SHA256
+// от всего предыдущего текста, поэтому подменить ID в кнопке нельзя.
+// Telegram ограничивает callback data 64 байтами — это проверяется при кодировании.
+
+const (
+	callbackVersion = "1"
+	callbackSep     = "|"
+	callbackMaxLen  = 64
+	callbackSigLen  = 9 // байт HMAC → 12 символов base64url
+)
+
+var (
+	errCallbackMalformed = errors.New("malformed callback data")
+	errCallbackVersion   = errors.New("unsupported callback data version")
+	errCallbackRoute     = errors.New("unknown callback route")
+	errCallbackSignature = errors.New("bad callback signature")
+)
+
+type cbArgKind int
+
+const (
+	cbInt64 cbArgKind = iota
+	cbString
+)
+
+// callbackArgs — аргументы, уже декодированные по типам маршрута
+type callbackArgs []any
+
+func (a callbackArgs) Int64(i int) int64   { return a[i].(int64) }
+func (a callbackArgs) String(i int) string { return a[i].(string) }
+
+type callbackHandler func(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs)
+
+type callbackRoute struct {
+	Name    string
+	Args    []cbArgKind
+	Signed  bool
+	Handler callbackHandler
+}
+
+type callbackRouter struct {
+	mu     sync.RWMutex
+	routes map[string]callbackRoute
+	key    []byte
+}
+
+var callbacks = &callbackRouter{routes: map[string]callbackRoute{}}
+
+// setKey задаёт ключ HMAC для подписанных маршрутов
+func (r *callbackRouter) setKey(key []byte) {
+	r.mu.Lock()
+	r.key = key
+	r.mu.Unlock()
+}
+
+// handle регистрирует маршрут; повторное имя — ошибка программиста
+func (r *callbackRouter) handle(route callbackRoute) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.routes[route.Name]; dup {
+		panic("callback route registered twice: " + route.Name)
+	}
+	if strings.Contains(route.Name, callbackSep) {
+		panic("callback route name contains separator: " + route.Name)
+	}
+	r.routes[route.Name] = route
+}
+
+// encode собирает callback data для маршрута. Неизвестный маршрут, неверные
+// аргументы или превышение 64 байт — ошибка программиста, поэтому panic.
+func (r *callbackRouter) encode(name string, args ...any) string {
+	r.mu.RLock()
+	route, ok := r.routes[name]
+	key := r.key
+	r.mu.RUnlock()
+	if !ok {
+		panic("unknown callback route: " + name)
+	}
+	if len(args) != len(route.Args) {
+		panic(fmt.Sprintf("callback route %s: want %d args, got %d", name, len(route.Args), len(args)))
+	}
+	parts := []string{callbackVersion, name}
+	for i, kind := range route.Args {
+		switch kind {
+		case cbInt64:
+			v, ok := args[i].(int64)
+			if !ok {
+				panic(fmt.Sprintf("callback route %s: arg %d must be int64", name, i))
+			}
+			parts = append(parts, strconv.FormatInt(v, 36))
+		case cbString:
+			v, ok := args[i].(string)
+			if !ok || strings.Contains(v, callbackSep) {
+				panic(fmt.Sprintf("callback route %s: arg %d must be a string without %q", name, i, callbackSep))
+			}
+			parts = append(parts, v)
+		}
+	}
+	data := strings.Join(parts, callbackSep)
+	if route.Signed {
+		data += callbackSep + signCallback(key, data)
+	}
+	if len(data) > callbackMaxLen {
+		panic(fmt.Sprintf("callback data for %s exceeds %d bytes: %d", name, callbackMaxLen, len(data)))
+	}
+	return data
+}
+
+// decode разбирает и проверяет callback data, возвращая маршрут и типизированные аргументы
+func (r *callbackRouter) decode(data string) (callbackRoute, callbackArgs, error) {
+	parts := strings.Split(data, callbackSep)
+	if len(parts) < 2 {
+		return callbackRoute{}, nil, errCallbackMalformed
+	}
+	if parts[0] != callbackVersion {
+		return callbackRoute{}, nil, errCallbackVersion
+	}
+	r.mu.RLock()
+	route, ok := r.routes[parts[1]]
+	key := r.key
+	r.mu.RUnlock()
+	if !ok {
+		return callbackRoute{}, nil, errCallbackRoute
+	}
+	fields := parts[2:]
+	if route.Signed {
+		if len(fields) == 0 {
+			return callbackRoute{}, nil, errCallbackSignature
+		}
+		sig := fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+		signed := data[:len(data)-len(sig)-len(callbackSep)]
+		if !hmac.Equal([]byte(sig), []byte(signCallback(key, signed))) {
+			return callbackRoute{}, nil, errCallbackSignature
+		}
+	}
+	if len(fields) != len(route.Args) {
+		return callbackRoute{}, nil, errCallbackMalformed
+	}
+	args := make(callbackArgs, len(fields))
+	for i, kind := range route.Args {
+		switch kind {
+		case cbInt64:
+			v, err := strconv.ParseInt(fields[i], 36, 64)
+			if err != nil {
+				return callbackRoute{}, nil, fmt.Errorf("%w: arg %d: %v", errCallbackMalformed, i, err)
+			}
+			args[i] = v
+		case cbString:
+			args[i] = fields[i]
+		}
+	}
+	return route, args, nil
+}
+
+func signCallback(key []byte, data string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSigLen])
+}
+
+// callbackKey возвращает ключ подписи: CALLBACK_SECRET или производный от токена бота
+func callbackKey(cfg Config) []byte {
+	if cfg.CallbackSecret != "" {
+		return []byte(cfg.CallbackSecret)
+	}
+	sum := sha256.Sum256([]byte("conectwork/callback:" + cfg.TelegramToken))
+	return sum[:]
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func testCallbackRouter() *callbackRouter {
+	r := &callbackRouter{routes: map[string]callbackRoute{}}
+	r.setKey([]byte("test-key"))
+	r.handle(callbackRoute{Name: "order.connect", Args: []cbArgKind{cbInt64}, Signed: true})
+	r.handle(callbackRoute{Name: "menu", Args: []cbArgKind{cbString}})
+	return r
+}
+
+func TestCallbackRoundTrip(t *testing.T) {
+	r := testCallbackRouter()
+	data := r.encode("order.connect", int64(123456789))
+	route, args, err := r.decode(data)
+	if err != nil {
+		t.Fatalf("decode(%q): %v", data, err)
+	}
+	if route.Name != "order.connect" || args.Int64(0) != 123456789 {
+		t.Fatalf("decode(%q) = %s %v", data, route.Name, args)
+	}
+}
+
+func TestCallbackRejectsBadSignature(t *testing.T) {
+	r := testCallbackRouter()
+	data := r.encode("order.connect", int64(42))
+	sig := data[strings.LastIndex(data, callbackSep)+1:]
+	// последний символ подписи заменяем на другой допустимый символ base64url
+	flip := "A"
+	if strings.HasSuffix(sig, flip) {
+		flip = "B"
+	}
+	other := &callbackRouter{routes: r.routes}
+	other.setKey([]byte("other-key"))
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"подменён ID", strings.Replace(data, "|16|", "|17|", 1)}, // 42 в base36 — "16"
+		{"испорчена подпись", data[:len(data)-1] + flip},
+		{"подпись усечена", data[:len(data)-2]},
+		{"подпись отрезана", data[:strings.LastIndex(data, callbackSep)]},
+		{"пустая подпись", data[:strings.LastIndex(data, callbackSep)+1]},
+		{"без аргументов и подписи", "1|order.connect"},
+		{"подписано другим ключом", other.encode("order.connect", int64(42))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.data == data {
+				t.Fatalf("case does not change %q", data)
+			}
+			if _, _, err := r.decode(tt.data); !errors.Is(err, errCallbackSignature) {
+				t.Fatalf("decode(%q) err = %v, want %v", tt.data, err, errCallbackSignature)
+			}
+		})
+	}
+}
+
+func TestCallbackDecodeErrors(t *testing.T) {
+	r := testCallbackRouter()
+	tests := []struct {
+		data string
+		want error
+	}{
+		{"", errCallbackMalformed},
+		{"1", errCallbackMalformed},
+		{"2|menu|x", errCallbackVersion},
+		{"1|nope|x", errCallbackRoute},
+		{"1|menu", errCallbackMalformed},
+		{"1|menu|a|b", errCallbackMalformed},
+	}
+	for _, tt := range tests {
+		if _, _, err := r.decode(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("decode(%q) err = %v, want %v", tt.data, err, tt.want)
+		}
+	}
+}
+
+func TestCallbackMaxLen(t *testing.T) {
+	r := testCallbackRouter()
+	// самый длинный ID в подписанном маршруте укладывается в 64 байта
+	if data := r.encode("order.connect", int64(math.MinInt64)); len(data) > callbackMaxLen {
+		t.Fatalf("encode(MinInt64) = %d bytes, limit %d", len(data), callbackMaxLen)
+	}
+
+	prefix := len("1|menu|")
+	tests := []struct {
+		name      string
+		argLen    int
+		wantPanic bool
+	}{
+		{"ровно 64 байта", callbackMaxLen - prefix, false},
+		{"65 байт", callbackMaxLen - prefix + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if got := recover() != nil; got != tt.wantPanic {
+					t.Fatalf("panic = %v, want %v", got, tt.wantPanic)
+				}
+			}()
+			data := r.encode("menu", strings.Repeat("x", tt.argLen))
+			if len(data) != callbackMaxLen {
+				t.Fatalf("len = %d, want %d", len(data), callbackMaxLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Chat membership ------------------------
+// my_chat_member приходит, когда меняется статус самого бота: пользователь
+// заблокировал или разблокировал бота в личке, бота добавили в группу или
+// удалили из неё. Заблокировавшие бота пользователи помечаются Unreachable и
+// выпадают из рассылки новых анкет; группа, из которой бота удалили,
+// помечается недоступной, анкеты туда не публикуются, а админы (ADMIN_IDS)
+// получают предупреждение. chat_member (требует прав администратора в
+// группе) ведёт состав участников групп.
+
+// allowedUpdates — типы апдейтов, которые запрашиваются у Telegram;
+// chat_member без явного запроса не присылается
+var allowedUpdates = []string{"message", "edited_message", "callback_query", "my_chat_member", "chat_member"}
+
+// adminIDs — получатели служебных предупреждений, из ADMIN_IDS
+var adminIDs []int64
+
+func handleMyChatMember(ctx context.Context, b *Bot, m *tgbot.ChatMemberUpdated) {
+	status := m.NewChatMember.Status
+	if m.Chat.IsPrivate() {
+		setRoute(ctx, "my_chat_member:private")
+		u, err := getUser(ctx, m.From.ID)
+		if err != nil {
+			logger(ctx).Error("load user", slog.Any("err", err))
+			return
+		}
+		u.Unreachable = status == "kicked"
+		if err := storage.SaveUser(ctx, u); err != nil {
+			logger(ctx).Error("save user reachability", slog.Any("err", err))
+			return
+		}
+		logger(ctx).Info("user reachability changed", slog.Bool("unreachable", u.Unreachable))
+		return
+	}
+
+	setRoute(ctx, "my_chat_member:group")
+	g := GroupChat{ChatID: m.Chat.ID, Title: m.Chat.Title, BotStatus: status, UpdatedAt: time.Now()}
+	if err := storage.SaveGroupChat(ctx, g); err != nil {
+		logger(ctx).Error("save group chat", slog.Any("err", err))
+	}
+	logger(ctx).Info("bot status in group changed", slog.String("status", status), slog.String("title", g.Title))
+	if cat := groupCategory(g.ChatID); cat != "" && !g.Available() {
+		alertAdmins(ctx, b, func(lang string) string {
+			return T(lang, "admin.group_unavailable", g.Title, g.ChatID, categoryTitle(lang, cat), status)
+		})
+	}
+}
+
+func handleChatMember(ctx context.Context, m *tgbot.ChatMemberUpdated) {
+	setRoute(ctx, "chat_member")
+	user := m.NewChatMember.User
+	if user == nil {
+		return
+	}
+	if err := storage.SetGroupMember(ctx, m.Chat.ID, user.ID, m.NewChatMember.Status); err != nil {
+		logger(ctx).Error("save group member", slog.Int64("member_id", user.ID), slog.Any("err", err))
+	}
+}
+
+// handleEditedMessage: пока пользователь в мастере (профиль, анкета),
+// исправленное сообщение принимается как ответ на текущий шаг.
+// Вне мастера правки игнорируются.
+func handleEditedMessage(ctx context.Context, b *Bot, msg *tgbot.Message) {
+	if msg.From == nil || !inWizard(getUserState(msg.From.ID)) {
+		setRoute(ctx, "edited:ignored")
+		return
+	}
+	handleMessage(ctx, b, msg)
+}
+
+func inWizard(state string) bool {
+	return state == "creating_profile" || state == "editing_order" || strings.HasPrefix(state, "creating_order:")
+}
+
+// groupCategory возвращает категорию, анкеты которой публикуются в группу
+func groupCategory(chatID int64) string {
+	for cat, id := range categoryGroups {
+		if id == chatID {
+			return cat
+		}
+	}
+	return ""
+}
+
+// publishGroup — группа для публикации анкеты категории, 0 если её нет
+// или бот из неё удалён
+func publishGroup(ctx context.Context, category string) int64 {
+	groupID := categoryGroups[category]
+	if groupID == 0 {
+		return 0
+	}
+	if g, err := storage.GetGroupChat(ctx, groupID); err == nil && g != nil && !g.Available() {
+		logger(ctx).Warn("category group unavailable, not publishing",
+			slog.String("category", category), slog.Int64("group_id", groupID), slog.String("status", g.BotStatus))
+		return 0
+	}
+	return groupID
+}
+
+// alertAdmins отправляет предупреждение каждому админу на его языке
+func alertAdmins(ctx context.Context, b *Bot, text func(lang string) string) {
+	if len(adminIDs) == 0 {
+		slog.Warn("admin alert (ADMIN_IDS not set)", slog.String("text", text(defaultLang)))
+		return
+	}
+	for _, id := range adminIDs {
+		sendText(b, id, text(langOf(ctx, id)))
+	}
+}
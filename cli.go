@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ------------------------ CLI ------------------------
+// Подкоманды webhook позволяют проверить и поправить вебхук без редеплоя:
+// при запуске serve ошибки setWebhook только пишутся в лог.
+
+// webhookEndpoint — полный URL вебхука, который регистрируется в Telegram
+func webhookEndpoint(cfg Config) string {
+	return cfg.WebhookURL + "/webhook/" + cfg.WebhookSecret
+}
+
+// runWebhookCmd выполняет "webhook set|info|delete" и возвращает код выхода
+func runWebhookCmd(cfg Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	sub, args := args[0], args[1:]
+	fs := flag.NewFlagSet("webhook "+sub, flag.ContinueOnError)
+	switch sub {
+	case "set":
+		url := fs.String("url", "", "full webhook URL (default TELEGRAM_WEBHOOK_URL/webhook/<WEBHOOK_SECRET>)")
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if *url == "" {
+			if cfg.WebhookURL == "" || cfg.WebhookSecret == "" {
+				fmt.Fprintln(os.Stderr, "TELEGRAM_WEBHOOK_URL and WEBHOOK_SECRET are required (or pass -url)")
+				return 2
+			}
+			*url = webhookEndpoint(cfg)
+		}
+		bot := InitBot(cfg.TelegramToken)
+		if err := bot.SetWebhook(*url, webhookSecretToken(cfg)); err != nil {
+			fmt.Fprintf(os.Stderr, "setWebhook: %v\n", err)
+			return 1
+		}
+		fmt.Printf("webhook set to %s\n", *url)
+	case "info":
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		bot := InitBot(cfg.TelegramToken)
+		info, err := bot.WebhookInfo()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "getWebhookInfo: %v\n", err)
+			return 1
+		}
+		url := info.URL
+		if url == "" {
+			url = "(not set)"
+		}
+		fmt.Printf("url:             %s\n", url)
+		fmt.Printf("pending updates: %d\n", info.PendingUpdateCount)
+		if info.IPAddress != "" {
+			fmt.Printf("ip address:      %s\n", info.IPAddress)
+		}
+		if info.MaxConnections != 0 {
+			fmt.Printf("max connections: %d\n", info.MaxConnections)
+		}
+		if info.LastErrorDate != 0 {
+			at := time.Unix(int64(info.LastErrorDate), 0).UTC().Format(time.RFC3339)
+			fmt.Printf("last error:      %s (%s)\n", info.LastErrorMessage, at)
+		} else {
+			fmt.Println("last error:      none")
+		}
+	case "delete":
+		drop := fs.Bool("drop-pending", false, "also drop updates Telegram has not delivered yet")
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		bot := InitBot(cfg.TelegramToken)
+		if err := bot.DeleteWebhook(*drop); err != nil {
+			fmt.Fprintf(os.Stderr, "deleteWebhook: %v\n", err)
+			return 1
+		}
+		fmt.Println("webhook deleted")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown webhook command %q\n\n%s", sub, usage)
+		return 2
+	}
+	return 0
+}
+
+// runMigrateCmd выполняет "migrate up|down|status" над DATABASE_URL (Postgres или sqlite://)
+func runMigrateCmd(cfg Config, args []string) int {
+	if cfg.DatabaseURL == "" {
+		fmt.Fprintln(os.Stderr, "DATABASE_URL is required")
+		return 2
+	}
+	sub := "up"
+	if len(args) > 0 {
+		sub, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("migrate "+sub, flag.ContinueOnError)
+	to := fs.Int("to", 0, "migrate up to this version (default: latest)")
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	var db migrator
+	if path, ok := sqlitePath(cfg.DatabaseURL); ok {
+		sdb, err := openSQLite(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "open: %v\n", err)
+			return 1
+		}
+		defer sdb.Close()
+		db = &sqliteMigrator{db: sdb}
+	} else {
+		pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "connect: %v\n", err)
+			return 1
+		}
+		defer pool.Close()
+		db = &pgMigrator{pool: pool}
+	}
+
+	var err error
+
+	switch sub {
+	case "up":
+		err = migrateUp(ctx, db, *to)
+	case "down":
+		err = migrateDown(ctx, db, *steps)
+	case "status":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%s", sub, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", sub, err)
+		return 1
+	}
+	lines, err := migrationStatus(ctx, db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate status: %v\n", err)
+		return 1
+	}
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	return 0
+}
@@ -3,29 +3,86 @@ package main
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
+)
+
+// Режимы получения апдейтов
+const (
+	ModeWebhook = "webhook"
+	ModePolling = "polling"
 )
 
 type Config struct {
+	Mode               string
 	TelegramToken      string
 	WebhookSecret      string
 	WebhookURL         string
+	WebhookSecretToken string
+	WebhookCIDRs       string
+	WebhookTrustProxy  bool
+	CallbackSecret     string
 	DatabaseURL        string
 	DesignGroupID      int64
 	ProgrammingGroupID int64
 	ContentGroupID     int64
 	Port               string
+	UpdateWorkers      int
+	SendWorkers        int
+	UpdateQueueSize    int
+	ShardQueueSize     int
+	SendQueueSize      int
+	DeadLetterPath     string
+	LogLevel           string
+	LogFormat          string
+	LogMessageText     bool
+	AdminIDs           []int64
+	UpdateTimeout      time.Duration
+	JSONBackups        int
+	JSONRecover        bool
 }
 
 func LoadConfigFromEnv() Config {
+	mode := os.Getenv("MODE")
+	if mode == "" {
+		mode = ModeWebhook
+	}
 	return Config{
+		Mode:               mode,
 		TelegramToken:      os.Getenv("TELEGRAM_BOT_TOKEN"),
 		WebhookSecret:      os.Getenv("WEBHOOK_SECRET"),
 		WebhookURL:         os.Getenv("TELEGRAM_WEBHOOK_URL"),
+		WebhookSecretToken: os.Getenv("WEBHOOK_SECRET_TOKEN"),
+		WebhookCIDRs:       os.Getenv("WEBHOOK_ALLOWED_CIDRS"),
+		WebhookTrustProxy:  os.Getenv("WEBHOOK_TRUST_PROXY") == "true",
+		CallbackSecret:     os.Getenv("CALLBACK_SECRET"),
 		DatabaseURL:        os.Getenv("DATABASE_URL"),
 		DesignGroupID:      parseEnvInt64("DESIGN_GROUP_ID"),
 		ProgrammingGroupID: parseEnvInt64("PROGRAMMING_GROUP_ID"),
 		ContentGroupID:     parseEnvInt64("CONTENT_GROUP_ID"),
 		Port:               os.Getenv("PORT"),
+		UpdateWorkers:      parseEnvInt("UPDATE_WORKERS", 8),
+		SendWorkers:        parseEnvInt("SEND_WORKERS", 4),
+		UpdateQueueSize:    parseEnvInt("UPDATE_QUEUE_SIZE", 100),
+		ShardQueueSize:     parseEnvInt("SHARD_QUEUE_SIZE", 16),
+		SendQueueSize:      parseEnvInt("SEND_QUEUE_SIZE", 1000),
+		DeadLetterPath:     os.Getenv("DEAD_LETTER_PATH"),
+		LogLevel:           os.Getenv("LOG_LEVEL"),
+		LogFormat:          os.Getenv("LOG_FORMAT"),
+		LogMessageText:     os.Getenv("LOG_MESSAGE_TEXT") == "true",
+		AdminIDs:           parseEnvInt64List("ADMIN_IDS"),
+		UpdateTimeout:      time.Duration(parseEnvInt("UPDATE_TIMEOUT_SECONDS", 30)) * time.Second,
+		JSONBackups:        parseEnvInt("JSON_STORAGE_BACKUPS", 3),
+		JSONRecover:        os.Getenv("JSON_STORAGE_RECOVER") == "true",
+	}
+}
+
+// CategoryGroups сопоставляет категории анкет с группами, куда они публикуются
+func (c Config) CategoryGroups() map[string]int64 {
+	return map[string]int64{
+		"design":      c.DesignGroupID,
+		"programming": c.ProgrammingGroupID,
+		"content":     c.ContentGroupID,
 	}
 }
 
@@ -37,3 +94,23 @@ func parseEnvInt64(k string) int64 {
 	out, _ := strconv.ParseInt(v, 10, 64)
 	return out
 }
+
+// parseEnvInt64List читает список ID через запятую; некорректные элементы пропускаются
+func parseEnvInt64List(k string) []int64 {
+	var out []int64
+	for _, s := range strings.Split(os.Getenv(k), ",") {
+		if v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parseEnvInt читает положительное целое из окружения, иначе возвращает def
+func parseEnvInt(k string, def int) int {
+	out, err := strconv.Atoi(os.Getenv(k))
+	if err != nil || out <= 0 {
+		return def
+	}
+	return out
+}
@@ -3,26 +3,59 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var storage Storage
 
+// Storage — хранилище бота. Отсутствие записи, дубликаты, конфликты и бан
+// возвращаются одинаковыми для всех реализаций ошибками из errors.go.
 type Storage interface {
-	CreateOrUpdateProfile(p Profile) error
-	GetProfile(userID int64) (*Profile, error)
-	CreateOrder(o Order) (int64, error)
-	GetOrderByCreator(userID int64) (*Order, error)
-	GetOrderByID(id int64) (*Order, error)
-	DeleteOrderByID(id int64) error
-	UpdateOrder(o Order) error
-	IncrementComplaint(orderID int64, reporterID int64) (int, error)
-	ListOrdersByCategory(cat string) ([]Order, error)
+	CreateOrUpdateProfile(ctx context.Context, p Profile) error
+	GetProfile(ctx context.Context, userID int64) (*Profile, error)
+	DeleteProfile(ctx context.Context, userID int64) error
+	GetUser(ctx context.Context, userID int64) (*User, error)
+	// SaveUser сохраняет настройки пользователя; флаг Banned не записывается,
+	// его меняет только SetUserBanned
+	SaveUser(ctx context.Context, u User) error
+	// SetUserBanned блокирует или разблокирует пользователя, создавая запись о нём при необходимости
+	SetUserBanned(ctx context.Context, userID int64, banned bool) error
+	ListSubscribers(ctx context.Context, category string) ([]int64, error)
+	ListSearchableProfiles(ctx context.Context, limit int) ([]Profile, error)
+	GetGroupChat(ctx context.Context, chatID int64) (*GroupChat, error)
+	SaveGroupChat(ctx context.Context, g GroupChat) error
+	SetGroupMember(ctx context.Context, chatID, userID int64, status string) error
+	// CreateOrder создаёт анкету; notices (может быть nil) получает анкету с ID
+	// и возвращает уведомления, которые попадут в outbox в той же транзакции.
+	// notices не должна обращаться к storage.
+	CreateOrder(ctx context.Context, o Order, notices func(Order) []OutboxMessage) (int64, error)
+	GetOrderByCreator(ctx context.Context, userID int64) (*Order, error)
+	GetOrderByID(ctx context.Context, id int64) (*Order, error)
+	DeleteOrderByID(ctx context.Context, id int64, notices ...OutboxMessage) error
+	UpdateOrder(ctx context.Context, o Order) error
+	IncrementComplaint(ctx context.Context, orderID int64, reporterID int64) (int, error)
+	ListOrdersByCategory(ctx context.Context, cat string) ([]Order, error)
+	OrderStats(ctx context.Context) ([]OrderStats, error)
+	EnqueueOutbox(ctx context.Context, msgs ...OutboxMessage) error
+	ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, id int64) error
+	MarkOutboxFailed(ctx context.Context, id int64, reason string) error
+	// MarkUpdateSeen возвращает true, если update_id встретился впервые
+	MarkUpdateSeen(ctx context.Context, updateID int) (bool, error)
+	ForgetUpdate(ctx context.Context, updateID int) error
+	PruneSeenUpdates(ctx context.Context, olderThan time.Duration) error
+	// PruneOutbox удаляет отправленные и отклонённые сообщения outbox старше olderThan
+	PruneOutbox(ctx context.Context, olderThan time.Duration) error
+	// Ping проверяет, что хранилище доступно на запись (для /readyz)
+	Ping(ctx context.Context) error
 	Close() error
 }
 
@@ -30,72 +63,342 @@ type Storage interface {
 // JSON file fallback (not recommended for production)
 ////////////////////////////////////////////////////////////////////////////////
 
+// JSONStorage — хранилище в файле (см. jsonFile). Изменяющие методы возвращают
+// управление, как только строка записана в журнал, не дожидаясь fsync: падение
+// процесса ничего не теряет, но при отключении питания или падении ОС пропадут
+// изменения последних jsonSyncDelay, о которых вызывающий уже получил nil.
+// Ждать fsync на каждую запись — заметно медленнее, а для запасного хранилища
+// такая потеря допустима; где она недопустима, нужен Postgres.
 type JSONStorage struct {
 	FilePath string
+	file     *jsonFile
 	mu       sync.Mutex
 	Data     struct {
 		Profiles map[int64]Profile `json:"profiles"`
 		Orders   map[int64]Order   `json:"orders"`
+		Users    map[int64]User    `json:"users"`
 		NextID   int64             `json:"next_id"`
+
+		Outbox       map[int64]OutboxMessage `json:"outbox"`
+		NextOutboxID int64                   `json:"next_outbox_id"`
+
+		Groups       map[int64]GroupChat        `json:"groups"`
+		GroupMembers map[int64]map[int64]string `json:"group_members"` // chat -> user -> status
 	}
 }
 
-func InitJSONStorage(path string) error {
-	js := &JSONStorage{FilePath: path}
-	js.Data.Profiles = map[int64]Profile{}
-	js.Data.Orders = map[int64]Order{}
+// InitJSONStorage загружает path (см. jsonFile.load) и хранит до backups
+// резервных копий
+func InitJSONStorage(path string, backups int, recoverCorrupt bool) error {
+	js := &JSONStorage{FilePath: path, file: newJSONFile(path, backups)}
 	js.Data.NextID = 1
-	if _, err := os.Stat(path); err == nil {
-		b, _ := os.ReadFile(path)
-		_ = json.Unmarshal(b, &js.Data)
+	pending, err := js.file.load(&js.Data, recoverCorrupt, js.replay)
+	if err != nil {
+		return err
+	}
+	js.initMaps()
+	// журнал после падения может заканчиваться недописанной строкой — начинаем с чистого
+	if pending || recoverCorrupt {
+		if err := js.compact(); err != nil {
+			return err
+		}
 	}
+	go js.file.run(js.compactIfNeeded)
 	storage = js
 	return nil
 }
 
-func (j *JSONStorage) persist() error {
+// jsonOp — операция журнала: новое значение строки таблицы T с ключом K
+// целиком или её удаление (пустое V). Таблицы названы как поля Data в JSON.
+type jsonOp struct {
+	T string          `json:"t"`
+	K int64           `json:"k"`
+	V json.RawMessage `json:"v,omitempty"`
+}
+
+func jsonPut(table string, key int64, v any) jsonOp {
+	// значения — структуры модели из простых типов, Marshal для них не ошибается
+	b, _ := json.Marshal(v)
+	return jsonOp{T: table, K: key, V: b}
+}
+
+func jsonDelete(table string, key int64) jsonOp {
+	return jsonOp{T: table, K: key}
+}
+
+// commit записывает пачку операций одной строкой журнала и применяет их к Data.
+// Вызывается под j.mu; Data меняется только здесь и при загрузке.
+func (j *JSONStorage) commit(ops ...jsonOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	if err := j.file.append(line); err != nil {
+		return err
+	}
+	return j.replay(line)
+}
+
+// initMaps создаёт таблицы, которых нет в снимке (пустое хранилище или старый формат)
+func (j *JSONStorage) initMaps() {
+	if j.Data.Profiles == nil {
+		j.Data.Profiles = map[int64]Profile{}
+	}
+	if j.Data.Orders == nil {
+		j.Data.Orders = map[int64]Order{}
+	}
+	if j.Data.Users == nil {
+		j.Data.Users = map[int64]User{}
+	}
+	if j.Data.Outbox == nil {
+		j.Data.Outbox = map[int64]OutboxMessage{}
+	}
+	if j.Data.Groups == nil {
+		j.Data.Groups = map[int64]GroupChat{}
+	}
+	if j.Data.GroupMembers == nil {
+		j.Data.GroupMembers = map[int64]map[int64]string{}
+	}
+}
+
+// replay применяет строку журнала
+func (j *JSONStorage) replay(line []byte) error {
+	var ops []jsonOp
+	if err := json.Unmarshal(line, &ops); err != nil {
+		return err
+	}
+	j.initMaps()
+	for _, op := range ops {
+		if err := j.apply(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *JSONStorage) apply(op jsonOp) error {
+	switch op.T {
+	case "profiles":
+		return applyJSONOp(j.Data.Profiles, op)
+	case "orders":
+		if op.K >= j.Data.NextID {
+			j.Data.NextID = op.K + 1
+		}
+		return applyJSONOp(j.Data.Orders, op)
+	case "users":
+		return applyJSONOp(j.Data.Users, op)
+	case "outbox":
+		if op.K >= j.Data.NextOutboxID {
+			j.Data.NextOutboxID = op.K + 1
+		}
+		return applyJSONOp(j.Data.Outbox, op)
+	case "groups":
+		return applyJSONOp(j.Data.Groups, op)
+	case "group_members":
+		return applyJSONOp(j.Data.GroupMembers, op)
+	}
+	return fmt.Errorf("unknown table %q", op.T)
+}
+
+func applyJSONOp[T any](m map[int64]T, op jsonOp) error {
+	if len(op.V) == 0 {
+		delete(m, op.K)
+		return nil
+	}
+	var v T
+	if err := json.Unmarshal(op.V, &v); err != nil {
+		return err
+	}
+	m[op.K] = v
+	return nil
+}
+
+// compact сжимает журнал в новый снимок
+func (j *JSONStorage) compact() error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
+	// в снимок не попадают давно отправленные сообщения outbox: журнал
+	// очищается вместе с записью снимка, так что удаление не нужно журналировать
+	cutoff := time.Now().Add(-outboxRetention)
+	for id, m := range j.Data.Outbox {
+		if m.finishedBefore(cutoff) {
+			delete(j.Data.Outbox, id)
+		}
+	}
 	b, err := json.MarshalIndent(j.Data, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(j.FilePath, b, 0644)
+	return j.file.writeSnapshot(b)
 }
 
-func (j *JSONStorage) CreateOrUpdateProfile(p Profile) error {
+func (j *JSONStorage) compactIfNeeded() {
+	j.mu.Lock()
+	need := j.file.needsCompaction()
+	j.mu.Unlock()
+	if need {
+		_ = j.compact() // ошибка уже в логе и в Ping; журнал остаётся, повторим позже
+	}
+}
+
+// banned вызывается под j.mu
+func (j *JSONStorage) banned(userID int64) bool {
+	return j.Data.Users[userID].Banned
+}
+
+func (j *JSONStorage) CreateOrUpdateProfile(ctx context.Context, p Profile) error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	j.Data.Profiles[p.UserID] = p
-	return j.persist()
+	if j.banned(p.UserID) {
+		return ErrBanned
+	}
+	p.UpdatedAt = time.Now()
+	return j.commit(jsonPut("profiles", p.UserID, p))
 }
 
-func (j *JSONStorage) GetProfile(userID int64) (*Profile, error) {
+func (j *JSONStorage) GetProfile(ctx context.Context, userID int64) (*Profile, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 	if p, ok := j.Data.Profiles[userID]; ok {
 		return &p, nil
 	}
-	return nil, errors.New("not found")
+	return nil, ErrNotFound
+}
+
+func (j *JSONStorage) DeleteProfile(ctx context.Context, userID int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.Data.Profiles[userID]; !ok {
+		return ErrNotFound
+	}
+	return j.commit(jsonDelete("profiles", userID))
+}
+
+func (j *JSONStorage) GetUser(ctx context.Context, userID int64) (*User, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if u, ok := j.Data.Users[userID]; ok {
+		return &u, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (j *JSONStorage) SaveUser(ctx context.Context, u User) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	u.Banned = j.banned(u.UserID)
+	return j.commit(jsonPut("users", u.UserID, u))
+}
+
+func (j *JSONStorage) SetUserBanned(ctx context.Context, userID int64, banned bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	u, ok := j.Data.Users[userID]
+	if !ok {
+		u = User{UserID: userID}
+	}
+	u.Banned = banned
+	return j.commit(jsonPut("users", userID, u))
+}
+
+func (j *JSONStorage) ListSubscribers(ctx context.Context, category string) ([]int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []int64
+	for uid := range j.Data.Profiles {
+		if u, ok := j.Data.Users[uid]; ok && u.NotifiesAbout(category) && !u.Unreachable && !u.Banned {
+			out = append(out, uid)
+		}
+	}
+	return out, nil
 }
 
-func (j *JSONStorage) CreateOrder(o Order) (int64, error) {
+func (j *JSONStorage) GetGroupChat(ctx context.Context, chatID int64) (*GroupChat, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
+	if g, ok := j.Data.Groups[chatID]; ok {
+		return &g, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (j *JSONStorage) SaveGroupChat(ctx context.Context, g GroupChat) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.commit(jsonPut("groups", g.ChatID, g))
+}
+
+// SetGroupMember запоминает статус участника группы; ушедшие удаляются
+func (j *JSONStorage) SetGroupMember(ctx context.Context, chatID, userID int64, status string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	members := map[int64]string{}
+	for uid, st := range j.Data.GroupMembers[chatID] {
+		members[uid] = st
+	}
+	if status == "left" || status == "kicked" {
+		delete(members, userID)
+	} else {
+		members[userID] = status
+	}
+	if len(members) == 0 {
+		return j.commit(jsonDelete("group_members", chatID))
+	}
+	return j.commit(jsonPut("group_members", chatID, members))
+}
+
+func (j *JSONStorage) ListSearchableProfiles(ctx context.Context, limit int) ([]Profile, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []Profile
+	for uid, p := range j.Data.Profiles {
+		if u, ok := j.Data.Users[uid]; ok && (u.HiddenFromSearch || u.Banned) {
+			continue
+		}
+		out = append(out, p)
+	}
+	// как в SQL: сначала недавно обновлённые
+	sort.Slice(out, func(a, b int) bool {
+		if !out[a].UpdatedAt.Equal(out[b].UpdatedAt) {
+			return out[a].UpdatedAt.After(out[b].UpdatedAt)
+		}
+		return out[a].UserID < out[b].UserID
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (j *JSONStorage) CreateOrder(ctx context.Context, o Order, notices func(Order) []OutboxMessage) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := validateOrder(o); err != nil {
+		return 0, err
+	}
+	if j.banned(o.CreatorID) {
+		return 0, ErrBanned
+	}
 	for _, od := range j.Data.Orders {
 		if od.CreatorID == o.CreatorID {
-			return 0, errors.New("creator already has an order")
+			return 0, ErrActiveOrderExists
 		}
 	}
-	id := j.Data.NextID
-	o.ID = id
-	j.Data.Orders[id] = o
-	j.Data.NextID++
-	_ = j.persist()
-	return id, nil
+	o.ID = j.Data.NextID
+	ops := []jsonOp{jsonPut("orders", o.ID, o)}
+	if notices != nil {
+		ops = append(ops, j.outboxOps(notices(o))...)
+	}
+	if err := j.commit(ops...); err != nil {
+		return 0, err
+	}
+	return o.ID, nil
 }
 
-func (j *JSONStorage) GetOrderByCreator(userID int64) (*Order, error) {
+func (j *JSONStorage) GetOrderByCreator(ctx context.Context, userID int64) (*Order, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 	for _, od := range j.Data.Orders {
@@ -104,47 +407,59 @@ func (j *JSONStorage) GetOrderByCreator(userID int64) (*Order, error) {
 			return &temp, nil
 		}
 	}
-	return nil, errors.New("not found")
+	return nil, ErrNotFound
 }
 
-func (j *JSONStorage) GetOrderByID(id int64) (*Order, error) {
+func (j *JSONStorage) GetOrderByID(ctx context.Context, id int64) (*Order, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 	if od, ok := j.Data.Orders[id]; ok {
 		temp := od
 		return &temp, nil
 	}
-	return nil, errors.New("not found")
+	return nil, ErrNotFound
 }
 
-func (j *JSONStorage) DeleteOrderByID(id int64) error {
+func (j *JSONStorage) DeleteOrderByID(ctx context.Context, id int64, notices ...OutboxMessage) error {
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	delete(j.Data.Orders, id)
-	return j.persist()
+	if _, ok := j.Data.Orders[id]; !ok {
+		return ErrNotFound
+	}
+	return j.commit(append([]jsonOp{jsonDelete("orders", id)}, j.outboxOps(notices)...)...)
 }
 
-func (j *JSONStorage) UpdateOrder(o Order) error {
+func (j *JSONStorage) UpdateOrder(ctx context.Context, o Order) error {
+	if err := validateOrder(o); err != nil {
+		return err
+	}
 	j.mu.Lock()
 	defer j.mu.Unlock()
-	j.Data.Orders[o.ID] = o
-	return j.persist()
+	// анкету закрыли, пока её редактировали
+	if _, ok := j.Data.Orders[o.ID]; !ok {
+		return ErrConflict
+	}
+	return j.commit(jsonPut("orders", o.ID, o))
 }
 
-func (j *JSONStorage) IncrementComplaint(orderID int64, reporterID int64) (int, error) {
+func (j *JSONStorage) IncrementComplaint(ctx context.Context, orderID int64, reporterID int64) (int, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
+	if j.banned(reporterID) {
+		return 0, ErrBanned
+	}
 	od, ok := j.Data.Orders[orderID]
 	if !ok {
-		return 0, errors.New("not found")
+		return 0, ErrNotFound
 	}
 	od.Complaints++
-	j.Data.Orders[orderID] = od
-	_ = j.persist()
+	if err := j.commit(jsonPut("orders", orderID, od)); err != nil {
+		return 0, err
+	}
 	return od.Complaints, nil
 }
 
-func (j *JSONStorage) ListOrdersByCategory(cat string) ([]Order, error) {
+func (j *JSONStorage) ListOrdersByCategory(ctx context.Context, cat string) ([]Order, error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 	var out []Order
@@ -153,10 +468,157 @@ func (j *JSONStorage) ListOrdersByCategory(cat string) ([]Order, error) {
 			out = append(out, od)
 		}
 	}
+	// ID выдаются по возрастанию при создании, так что это порядок created_at
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
 	return out, nil
 }
 
-func (j *JSONStorage) Close() error { return nil }
+func (j *JSONStorage) OrderStats(ctx context.Context) ([]OrderStats, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	byCat := map[string]*OrderStats{}
+	for _, od := range j.Data.Orders {
+		s, ok := byCat[od.Category]
+		if !ok {
+			s = &OrderStats{Category: od.Category}
+			byCat[od.Category] = s
+		}
+		s.Orders++
+		s.Complaints += od.Complaints
+	}
+	return withAllCategories(byCat), nil
+}
+
+// withAllCategories дополняет статистику нулями для категорий без анкет
+func withAllCategories(byCat map[string]*OrderStats) []OrderStats {
+	out := make([]OrderStats, 0, len(categories))
+	for _, cat := range categories {
+		if s, ok := byCat[cat]; ok {
+			out = append(out, *s)
+			delete(byCat, cat)
+		} else {
+			out = append(out, OrderStats{Category: cat})
+		}
+	}
+	for _, s := range byCat {
+		out = append(out, *s)
+	}
+	return out
+}
+
+// outboxOps — операции добавления сообщений в outbox, без уже известных DedupKey; вызывать под j.mu
+func (j *JSONStorage) outboxOps(msgs []OutboxMessage) []jsonOp {
+	seen := map[string]bool{}
+	for _, ex := range j.Data.Outbox {
+		seen[ex.DedupKey] = true
+	}
+	next := max(j.Data.NextOutboxID, 1)
+	var ops []jsonOp
+	for _, m := range msgs {
+		if seen[m.DedupKey] {
+			continue
+		}
+		seen[m.DedupKey] = true
+		m.ID = next
+		next++
+		ops = append(ops, jsonPut("outbox", m.ID, m))
+	}
+	return ops
+}
+
+func (j *JSONStorage) EnqueueOutbox(ctx context.Context, msgs ...OutboxMessage) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.commit(j.outboxOps(msgs)...)
+}
+
+func (j *JSONStorage) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	var out []OutboxMessage
+	for _, m := range j.Data.Outbox {
+		if !m.SentAt.IsZero() || !m.FailedAt.IsZero() || m.LockedUntil.After(now) {
+			continue
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	ops := make([]jsonOp, 0, len(out))
+	for i := range out {
+		out[i].Attempts++
+		out[i].LockedUntil = now.Add(lease)
+		ops = append(ops, jsonPut("outbox", out[i].ID, out[i]))
+	}
+	if err := j.commit(ops...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (j *JSONStorage) MarkOutboxSent(ctx context.Context, id int64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	m, ok := j.Data.Outbox[id]
+	if !ok {
+		return nil
+	}
+	m.SentAt = time.Now()
+	return j.commit(jsonPut("outbox", id, m))
+}
+
+func (j *JSONStorage) MarkOutboxFailed(ctx context.Context, id int64, reason string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	m, ok := j.Data.Outbox[id]
+	if !ok {
+		return nil
+	}
+	m.FailedAt = time.Now()
+	m.LastError = reason
+	return j.commit(jsonPut("outbox", id, m))
+}
+
+func (j *JSONStorage) PruneOutbox(ctx context.Context, olderThan time.Duration) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	cutoff := time.Now().Add(-olderThan)
+	var ops []jsonOp
+	for id, m := range j.Data.Outbox {
+		if m.finishedBefore(cutoff) {
+			ops = append(ops, jsonDelete("outbox", id))
+		}
+	}
+	return j.commit(ops...)
+}
+
+// JSON-хранилище работает в одной реплике, и кольца seenUpdates в памяти достаточно
+func (j *JSONStorage) MarkUpdateSeen(ctx context.Context, updateID int) (bool, error) {
+	return true, nil
+}
+
+func (j *JSONStorage) ForgetUpdate(ctx context.Context, updateID int) error { return nil }
+
+func (j *JSONStorage) PruneSeenUpdates(ctx context.Context, olderThan time.Duration) error {
+	return nil
+}
+
+func (j *JSONStorage) Ping(ctx context.Context) error {
+	if err := j.file.err(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.FilePath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Close сжимает журнал в снимок
+func (j *JSONStorage) Close() error { return j.file.close(j.compact) }
 
 ////////////////////////////////////////////////////////////////////////////////
 // Postgres implementation
@@ -173,27 +635,8 @@ func InitPostgres(databaseURL string) error {
 	}
 	pgpool = pool
 
-	_, err = pgpool.Exec(ctx, `
-CREATE TABLE IF NOT EXISTS profiles (
-	user_id BIGINT PRIMARY KEY,
-	username TEXT,
-	description TEXT,
-	photo_file_id TEXT,
-	updated_at TIMESTAMP DEFAULT NOW()
-);
-CREATE TABLE IF NOT EXISTS orders (
-	id BIGSERIAL PRIMARY KEY,
-	creator_id BIGINT,
-	category TEXT,
-	text TEXT,
-	photo_file_id TEXT,
-	group_message_id BIGINT,
-	complaints INT DEFAULT 0,
-	created_at TIMESTAMP DEFAULT NOW()
-);
-`)
-	if err != nil {
-		return err
+	if err := migrateUp(ctx, &pgMigrator{pool: pgpool}, 0); err != nil {
+		return fmt.Errorf("migrate: %w", err)
 	}
 	storage = &PostgresStorage{}
 	return nil
@@ -201,88 +644,230 @@ CREATE TABLE IF NOT EXISTS orders (
 
 type PostgresStorage struct{}
 
-func (p *PostgresStorage) CreateOrUpdateProfile(pr Profile) error {
-	ctx := context.Background()
-	_, err := pgpool.Exec(ctx, `INSERT INTO profiles (user_id, username, description, photo_file_id, updated_at)
+func (p *PostgresStorage) CreateOrUpdateProfile(ctx context.Context, pr Profile) error {
+	return mapPgError(pgx.BeginFunc(ctx, pgpool, func(tx pgx.Tx) error {
+		if err := ensureUser(ctx, tx, pr.UserID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO profiles (user_id, username, description, photo_file_id, updated_at)
 VALUES ($1,$2,$3,$4,$5)
 ON CONFLICT (user_id) DO UPDATE SET username=EXCLUDED.username, description=EXCLUDED.description, photo_file_id=EXCLUDED.photo_file_id, updated_at=EXCLUDED.updated_at
 `, pr.UserID, pr.Username, pr.Description, pr.PhotoFileID, time.Now())
-	return err
+		return err
+	}))
 }
 
-func (p *PostgresStorage) GetProfile(userID int64) (*Profile, error) {
-	ctx := context.Background()
+func (p *PostgresStorage) GetProfile(ctx context.Context, userID int64) (*Profile, error) {
 	var pr Profile
 	err := pgpool.QueryRow(ctx, `SELECT user_id, username, description, photo_file_id FROM profiles WHERE user_id=$1`, userID).
 		Scan(&pr.UserID, &pr.Username, &pr.Description, &pr.PhotoFileID)
 	if err != nil {
-		return nil, err
+		return nil, mapPgError(err)
 	}
 	return &pr, nil
 }
 
-func (p *PostgresStorage) CreateOrder(o Order) (int64, error) {
-	ctx := context.Background()
-	var exists bool
-	err := pgpool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM orders WHERE creator_id=$1)`, o.CreatorID).Scan(&exists)
+func (p *PostgresStorage) DeleteProfile(ctx context.Context, userID int64) error {
+	tag, err := pgpool.Exec(ctx, `DELETE FROM profiles WHERE user_id=$1`, userID)
+	if err != nil {
+		return mapPgError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *PostgresStorage) GetUser(ctx context.Context, userID int64) (*User, error) {
+	var u User
+	var notify string
+	err := pgpool.QueryRow(ctx, `SELECT user_id, language, language_code, notify_categories, contact_visibility, hidden_from_search, unreachable, banned
+FROM users WHERE user_id=$1`, userID).
+		Scan(&u.UserID, &u.Language, &u.LanguageCode, &notify, &u.ContactVisibility, &u.HiddenFromSearch, &u.Unreachable, &u.Banned)
 	if err != nil {
+		return nil, mapPgError(err)
+	}
+	if notify != "" {
+		u.NotifyCategories = strings.Split(notify, ",")
+	}
+	return &u, nil
+}
+
+func (p *PostgresStorage) SaveUser(ctx context.Context, u User) error {
+	_, err := pgpool.Exec(ctx, `INSERT INTO users (user_id, language, language_code, notify_categories, contact_visibility, hidden_from_search, unreachable, updated_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+ON CONFLICT (user_id) DO UPDATE SET language=EXCLUDED.language, language_code=EXCLUDED.language_code,
+	notify_categories=EXCLUDED.notify_categories, contact_visibility=EXCLUDED.contact_visibility,
+	hidden_from_search=EXCLUDED.hidden_from_search, unreachable=EXCLUDED.unreachable, updated_at=EXCLUDED.updated_at
+`, u.UserID, u.Language, u.LanguageCode, strings.Join(u.NotifyCategories, ","), u.ContactVisibility, u.HiddenFromSearch, u.Unreachable, time.Now())
+	return err
+}
+
+func (p *PostgresStorage) SetUserBanned(ctx context.Context, userID int64, banned bool) error {
+	_, err := pgpool.Exec(ctx, `INSERT INTO users (user_id, banned, updated_at) VALUES ($1,$2,NOW())
+ON CONFLICT (user_id) DO UPDATE SET banned=EXCLUDED.banned, updated_at=EXCLUDED.updated_at`, userID, banned)
+	return mapPgError(err)
+}
+
+// ListSubscribers возвращает исполнителей, включивших уведомления по категории
+func (p *PostgresStorage) ListSubscribers(ctx context.Context, category string) ([]int64, error) {
+	rows, err := pgpool.Query(ctx, `SELECT p.user_id FROM profiles p
+JOIN users u ON u.user_id = p.user_id
+WHERE NOT u.unreachable AND NOT u.banned AND ',' || u.notify_categories || ',' LIKE '%,' || $1 || ',%'`, category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		out = append(out, uid)
+	}
+	return out, rows.Err()
+}
+
+func (p *PostgresStorage) GetGroupChat(ctx context.Context, chatID int64) (*GroupChat, error) {
+	var g GroupChat
+	err := pgpool.QueryRow(ctx, `SELECT chat_id, title, bot_status, updated_at FROM group_chats WHERE chat_id=$1`, chatID).
+		Scan(&g.ChatID, &g.Title, &g.BotStatus, &g.UpdatedAt)
+	if err != nil {
+		return nil, mapPgError(err)
+	}
+	return &g, nil
+}
+
+func (p *PostgresStorage) SaveGroupChat(ctx context.Context, g GroupChat) error {
+	_, err := pgpool.Exec(ctx, `INSERT INTO group_chats (chat_id, title, bot_status, updated_at) VALUES ($1,$2,$3,$4)
+ON CONFLICT (chat_id) DO UPDATE SET title=EXCLUDED.title, bot_status=EXCLUDED.bot_status, updated_at=EXCLUDED.updated_at`,
+		g.ChatID, g.Title, g.BotStatus, g.UpdatedAt)
+	return err
+}
+
+func (p *PostgresStorage) SetGroupMember(ctx context.Context, chatID, userID int64, status string) error {
+	if status == "left" || status == "kicked" {
+		_, err := pgpool.Exec(ctx, `DELETE FROM group_members WHERE chat_id=$1 AND user_id=$2`, chatID, userID)
+		return err
+	}
+	_, err := pgpool.Exec(ctx, `INSERT INTO group_members (chat_id, user_id, status, updated_at) VALUES ($1,$2,$3,NOW())
+ON CONFLICT (chat_id, user_id) DO UPDATE SET status=EXCLUDED.status, updated_at=EXCLUDED.updated_at`, chatID, userID, status)
+	return err
+}
+
+func (p *PostgresStorage) ListSearchableProfiles(ctx context.Context, limit int) ([]Profile, error) {
+	rows, err := pgpool.Query(ctx, `SELECT p.user_id, p.username, p.description, p.photo_file_id FROM profiles p
+LEFT JOIN users u ON u.user_id = p.user_id
+WHERE NOT COALESCE(u.hidden_from_search, FALSE) AND NOT COALESCE(u.banned, FALSE)
+ORDER BY p.updated_at DESC
+LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Profile
+	for rows.Next() {
+		var pr Profile
+		if err := rows.Scan(&pr.UserID, &pr.Username, &pr.Description, &pr.PhotoFileID); err != nil {
+			return nil, err
+		}
+		out = append(out, pr)
+	}
+	return out, rows.Err()
+}
+
+func (p *PostgresStorage) CreateOrder(ctx context.Context, o Order, notices func(Order) []OutboxMessage) (int64, error) {
+	// «одна активная анкета» обеспечивает уникальный индекс orders_one_active_per_creator
+	tx, err := pgpool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	if err := ensureUser(ctx, tx, o.CreatorID); err != nil {
 		return 0, err
 	}
-	if exists {
-		return 0, errors.New("creator already has an order")
+	err = tx.QueryRow(ctx, `INSERT INTO orders (creator_id, category, text, photo_file_id) VALUES ($1,$2,$3,$4) RETURNING id`,
+		o.CreatorID, o.Category, o.Text, o.PhotoFileID).Scan(&o.ID)
+	if err != nil {
+		return 0, mapPgError(err)
+	}
+	if notices != nil {
+		if err := insertOutbox(ctx, tx, notices(o)); err != nil {
+			return 0, err
+		}
 	}
-	var id int64
-	err = pgpool.QueryRow(ctx, `INSERT INTO orders (creator_id, category, text, photo_file_id) VALUES ($1,$2,$3,$4) RETURNING id`,
-		o.CreatorID, o.Category, o.Text, o.PhotoFileID).Scan(&id)
-	return id, err
+	return o.ID, tx.Commit(ctx)
 }
 
-func (p *PostgresStorage) GetOrderByCreator(userID int64) (*Order, error) {
-	ctx := context.Background()
+func (p *PostgresStorage) GetOrderByCreator(ctx context.Context, userID int64) (*Order, error) {
 	var o Order
-	err := pgpool.QueryRow(ctx, `SELECT id, creator_id, category, text, photo_file_id, complaints FROM orders WHERE creator_id=$1`, userID).
+	err := pgpool.QueryRow(ctx, `SELECT id, creator_id, category, text, photo_file_id, complaints FROM orders WHERE creator_id=$1 AND status='active'`, userID).
 		Scan(&o.ID, &o.CreatorID, &o.Category, &o.Text, &o.PhotoFileID, &o.Complaints)
 	if err != nil {
-		return nil, err
+		return nil, mapPgError(err)
 	}
 	return &o, nil
 }
 
-func (p *PostgresStorage) GetOrderByID(id int64) (*Order, error) {
-	ctx := context.Background()
+func (p *PostgresStorage) GetOrderByID(ctx context.Context, id int64) (*Order, error) {
 	var o Order
-	err := pgpool.QueryRow(ctx, `SELECT id, creator_id, category, text, photo_file_id, complaints FROM orders WHERE id=$1`, id).
+	err := pgpool.QueryRow(ctx, `SELECT id, creator_id, category, text, photo_file_id, complaints FROM orders WHERE id=$1 AND status='active'`, id).
 		Scan(&o.ID, &o.CreatorID, &o.Category, &o.Text, &o.PhotoFileID, &o.Complaints)
 	if err != nil {
-		return nil, err
+		return nil, mapPgError(err)
 	}
 	return &o, nil
 }
 
-func (p *PostgresStorage) DeleteOrderByID(id int64) error {
-	ctx := context.Background()
-	_, err := pgpool.Exec(ctx, `DELETE FROM orders WHERE id=$1`, id)
-	return err
+func (p *PostgresStorage) DeleteOrderByID(ctx context.Context, id int64, notices ...OutboxMessage) error {
+	tx, err := pgpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `UPDATE orders SET status='closed', closed_at=NOW() WHERE id=$1 AND status='active'`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if err := insertOutbox(ctx, tx, notices); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-func (p *PostgresStorage) UpdateOrder(o Order) error {
-	ctx := context.Background()
-	_, err := pgpool.Exec(ctx, `UPDATE orders SET category=$1, text=$2, photo_file_id=$3 WHERE id=$4`,
+func (p *PostgresStorage) UpdateOrder(ctx context.Context, o Order) error {
+	tag, err := pgpool.Exec(ctx, `UPDATE orders SET category=$1, text=$2, photo_file_id=$3 WHERE id=$4 AND status='active'`,
 		o.Category, o.Text, o.PhotoFileID, o.ID)
-	return err
+	if err != nil {
+		return mapPgError(err)
+	}
+	// анкету закрыли, пока её редактировали
+	if tag.RowsAffected() == 0 {
+		return ErrConflict
+	}
+	return nil
 }
 
-func (p *PostgresStorage) IncrementComplaint(orderID int64, reporterID int64) (int, error) {
-	ctx := context.Background()
-	_, _ = pgpool.Exec(ctx, `UPDATE orders SET complaints = complaints + 1 WHERE id=$1`, orderID)
+func (p *PostgresStorage) IncrementComplaint(ctx context.Context, orderID int64, reporterID int64) (int, error) {
+	var banned bool
+	err := pgpool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1 AND banned)`, reporterID).Scan(&banned)
+	if err != nil {
+		return 0, err
+	}
+	if banned {
+		return 0, ErrBanned
+	}
 	var c int
-	err := pgpool.QueryRow(ctx, `SELECT complaints FROM orders WHERE id=$1`, orderID).Scan(&c)
-	return c, err
+	err = pgpool.QueryRow(ctx, `UPDATE orders SET complaints = complaints + 1 WHERE id=$1 AND status='active' RETURNING complaints`, orderID).Scan(&c)
+	return c, mapPgError(err)
 }
 
-func (p *PostgresStorage) ListOrdersByCategory(cat string) ([]Order, error) {
-	ctx := context.Background()
-	rows, err := pgpool.Query(ctx, `SELECT id, creator_id, category, text, photo_file_id, complaints FROM orders WHERE category=$1`, cat)
+func (p *PostgresStorage) ListOrdersByCategory(ctx context.Context, cat string) ([]Order, error) {
+	rows, err := pgpool.Query(ctx, `SELECT id, creator_id, category, text, photo_file_id, complaints FROM orders WHERE category=$1 AND status='active' ORDER BY created_at`, cat)
 	if err != nil {
 		return nil, err
 	}
@@ -290,10 +875,139 @@ func (p *PostgresStorage) ListOrdersByCategory(cat string) ([]Order, error) {
 	var out []Order
 	for rows.Next() {
 		var o Order
-		rows.Scan(&o.ID, &o.CreatorID, &o.Category, &o.Text, &o.PhotoFileID, &o.Complaints)
+		if err := rows.Scan(&o.ID, &o.CreatorID, &o.Category, &o.Text, &o.PhotoFileID, &o.Complaints); err != nil {
+			return nil, err
+		}
 		out = append(out, o)
 	}
-	return out, nil
+	return out, rows.Err()
+}
+
+func (p *PostgresStorage) OrderStats(ctx context.Context) ([]OrderStats, error) {
+	rows, err := pgpool.Query(ctx, `SELECT category, COUNT(*), COALESCE(SUM(complaints), 0) FROM orders WHERE status='active' GROUP BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byCat := map[string]*OrderStats{}
+	for rows.Next() {
+		var s OrderStats
+		if err := rows.Scan(&s.Category, &s.Orders, &s.Complaints); err != nil {
+			return nil, err
+		}
+		byCat[s.Category] = &s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return withAllCategories(byCat), nil
+}
+
+// ensureUser создаёт строку users, на которую ссылаются внешние ключи orders и profiles,
+// и возвращает ErrBanned для заблокированного пользователя. FOR SHARE не даёт
+// заблокировать пользователя, пока транзакция не завершится.
+func ensureUser(ctx context.Context, tx pgx.Tx, userID int64) error {
+	if _, err := tx.Exec(ctx, `INSERT INTO users (user_id) VALUES ($1) ON CONFLICT DO NOTHING`, userID); err != nil {
+		return err
+	}
+	var banned bool
+	if err := tx.QueryRow(ctx, `SELECT banned FROM users WHERE user_id=$1 FOR SHARE`, userID).Scan(&banned); err != nil {
+		return err
+	}
+	if banned {
+		return ErrBanned
+	}
+	return nil
+}
+
+// insertOutbox пишет сообщения в outbox внутри транзакции; дубликаты DedupKey пропускаются
+func insertOutbox(ctx context.Context, tx pgx.Tx, msgs []OutboxMessage) error {
+	for _, m := range msgs {
+		_, err := tx.Exec(ctx, `INSERT INTO outbox (dedup_key, chat_id, text, photo_file_id, parse_mode, reply_markup)
+VALUES ($1,$2,$3,$4,$5,$6) ON CONFLICT (dedup_key) DO NOTHING`,
+			m.DedupKey, m.ChatID, m.Text, m.PhotoFileID, m.ParseMode, m.ReplyMarkup)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *PostgresStorage) EnqueueOutbox(ctx context.Context, msgs ...OutboxMessage) error {
+	tx, err := pgpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if err := insertOutbox(ctx, tx, msgs); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ClaimOutbox арендует пачку неотправленных сообщений; SKIP LOCKED позволяет
+// нескольким репликам разбирать outbox параллельно, не мешая друг другу
+func (p *PostgresStorage) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	rows, err := pgpool.Query(ctx, `UPDATE outbox SET attempts = attempts + 1, locked_until = NOW() + make_interval(secs => $2)
+WHERE id IN (
+	SELECT id FROM outbox
+	WHERE sent_at IS NULL AND failed_at IS NULL AND (locked_until IS NULL OR locked_until < NOW())
+	ORDER BY id LIMIT $1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, dedup_key, chat_id, text, photo_file_id, parse_mode, reply_markup, attempts`, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.DedupKey, &m.ChatID, &m.Text, &m.PhotoFileID, &m.ParseMode, &m.ReplyMarkup, &m.Attempts); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out, rows.Err()
+}
+
+func (p *PostgresStorage) MarkOutboxSent(ctx context.Context, id int64) error {
+	_, err := pgpool.Exec(ctx, `UPDATE outbox SET sent_at = NOW(), locked_until = NULL WHERE id=$1`, id)
+	return err
+}
+
+func (p *PostgresStorage) MarkOutboxFailed(ctx context.Context, id int64, reason string) error {
+	_, err := pgpool.Exec(ctx, `UPDATE outbox SET failed_at = NOW(), last_error = $2, locked_until = NULL WHERE id=$1`, id, reason)
+	return err
+}
+
+func (p *PostgresStorage) MarkUpdateSeen(ctx context.Context, updateID int) (bool, error) {
+	tag, err := pgpool.Exec(ctx, `INSERT INTO seen_updates (update_id) VALUES ($1) ON CONFLICT DO NOTHING`, updateID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *PostgresStorage) ForgetUpdate(ctx context.Context, updateID int) error {
+	_, err := pgpool.Exec(ctx, `DELETE FROM seen_updates WHERE update_id=$1`, updateID)
+	return err
+}
+
+func (p *PostgresStorage) PruneOutbox(ctx context.Context, olderThan time.Duration) error {
+	_, err := pgpool.Exec(ctx, `DELETE FROM outbox
+WHERE sent_at < NOW() - make_interval(secs => $1) OR failed_at < NOW() - make_interval(secs => $1)`, olderThan.Seconds())
+	return err
+}
+
+func (p *PostgresStorage) PruneSeenUpdates(ctx context.Context, olderThan time.Duration) error {
+	_, err := pgpool.Exec(ctx, `DELETE FROM seen_updates WHERE seen_at < NOW() - make_interval(secs => $1)`, olderThan.Seconds())
+	return err
+}
+
+func (p *PostgresStorage) Ping(ctx context.Context) error {
+	return pgpool.Ping(ctx)
 }
 
 func (p *PostgresStorage) Close() error {
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// SQLite implementation
+////////////////////////////////////////////////////////////////////////////////
+// Встроенная база в одном файле для небольших сообществ: без отдельного
+// сервиса, как JSON, но с теми же миграциями и ограничениями, что у Postgres.
+// Драйвер modernc.org/sqlite написан на Go и собирается с CGO_ENABLED=0.
+// Рассчитано на одну реплику: все запросы идут через одно соединение, так что
+// транзакции не конкурируют за блокировку файла.
+
+// sqliteScheme — префикс DATABASE_URL для SQLite: sqlite:///data/bot.db
+const sqliteScheme = "sqlite://"
+
+// sqlitePath возвращает путь к файлу базы, если url указывает на SQLite
+func sqlitePath(url string) (string, bool) {
+	if !strings.HasPrefix(url, sqliteScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, sqliteScheme), true
+}
+
+// openSQLite открывает базу с внешними ключами, WAL и ожиданием блокировки
+func openSQLite(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+var sqliteDB *sql.DB
+
+func InitSQLite(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	db, err := openSQLite(path)
+	if err != nil {
+		return err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return err
+	}
+	if err := migrateUp(ctx, &sqliteMigrator{db: db}, 0); err != nil {
+		db.Close()
+		return fmt.Errorf("migrate: %w", err)
+	}
+	sqliteDB = db
+	storage = &SQLiteStorage{db: db}
+	return nil
+}
+
+// mapSQLiteError — аналог mapPgError: SQLite не сообщает имя уникального
+// индекса, поэтому нарушение уникальности orders.creator_id (единственный
+// частичный индекс на этой колонке) распознаётся по тексту ошибки
+func mapSQLiteError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	var sqlErr *sqlite.Error
+	if !errors.As(err, &sqlErr) {
+		return err
+	}
+	msg := sqlErr.Error()
+	switch sqlErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		if strings.Contains(msg, "orders.creator_id") {
+			return ErrActiveOrderExists
+		}
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, msg)
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		for name, domainErr := range constraintErrors {
+			if strings.Contains(msg, name) {
+				return domainErr
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrConflict, msg)
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		// все внешние ключи схемы ссылаются на users
+		return ErrUnknownUser
+	}
+	return err
+}
+
+// unixTime переводит секунды Unix из базы во время; NULL и 0 — нулевое время
+func unixTime(sec sql.NullInt64) time.Time {
+	if !sec.Valid || sec.Int64 == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec.Int64, 0)
+}
+
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// withTx выполняет fn в транзакции; запросы внутри fn должны идти через tx,
+// иначе они будут ждать единственное соединение
+func (s *SQLiteStorage) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ensureUser — аналог ensureUser для Postgres
+func (s *SQLiteStorage) ensureUser(ctx context.Context, tx *sql.Tx, userID int64) error {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO users (user_id) VALUES (?) ON CONFLICT DO NOTHING`, userID); err != nil {
+		return err
+	}
+	var banned bool
+	if err := tx.QueryRowContext(ctx, `SELECT banned FROM users WHERE user_id=?`, userID).Scan(&banned); err != nil {
+		return err
+	}
+	if banned {
+		return ErrBanned
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) CreateOrUpdateProfile(ctx context.Context, pr Profile) error {
+	return mapSQLiteError(s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.ensureUser(ctx, tx, pr.UserID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO profiles (user_id, username, description, photo_file_id, updated_at)
+VALUES (?,?,?,?,unixepoch())
+ON CONFLICT (user_id) DO UPDATE SET username=excluded.username, description=excluded.description, photo_file_id=excluded.photo_file_id, updated_at=excluded.updated_at`,
+			pr.UserID, pr.Username, pr.Description, pr.PhotoFileID)
+		return err
+	}))
+}
+
+func (s *SQLiteStorage) GetProfile(ctx context.Context, userID int64) (*Profile, error) {
+	var pr Profile
+	var username, description, photo sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT user_id, username, description, photo_file_id FROM profiles WHERE user_id=?`, userID).
+		Scan(&pr.UserID, &username, &description, &photo)
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+	pr.Username, pr.Description, pr.PhotoFileID = username.String, description.String, photo.String
+	return &pr, nil
+}
+
+func (s *SQLiteStorage) DeleteProfile(ctx context.Context, userID int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM profiles WHERE user_id=?`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) GetUser(ctx context.Context, userID int64) (*User, error) {
+	var u User
+	var notify string
+	err := s.db.QueryRowContext(ctx, `SELECT user_id, language, language_code, notify_categories, contact_visibility, hidden_from_search, unreachable, banned
+FROM users WHERE user_id=?`, userID).
+		Scan(&u.UserID, &u.Language, &u.LanguageCode, &notify, &u.ContactVisibility, &u.HiddenFromSearch, &u.Unreachable, &u.Banned)
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+	if notify != "" {
+		u.NotifyCategories = strings.Split(notify, ",")
+	}
+	return &u, nil
+}
+
+func (s *SQLiteStorage) SaveUser(ctx context.Context, u User) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO users (user_id, language, language_code, notify_categories, contact_visibility, hidden_from_search, unreachable, updated_at)
+VALUES (?,?,?,?,?,?,?,unixepoch())
+ON CONFLICT (user_id) DO UPDATE SET language=excluded.language, language_code=excluded.language_code,
+	notify_categories=excluded.notify_categories, contact_visibility=excluded.contact_visibility,
+	hidden_from_search=excluded.hidden_from_search, unreachable=excluded.unreachable, updated_at=excluded.updated_at`,
+		u.UserID, u.Language, u.LanguageCode, strings.Join(u.NotifyCategories, ","), u.ContactVisibility, u.HiddenFromSearch, u.Unreachable)
+	return err
+}
+
+func (s *SQLiteStorage) SetUserBanned(ctx context.Context, userID int64, banned bool) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO users (user_id, banned, updated_at) VALUES (?,?,unixepoch())
+ON CONFLICT (user_id) DO UPDATE SET banned=excluded.banned, updated_at=excluded.updated_at`, userID, banned)
+	return err
+}
+
+// ListSubscribers возвращает исполнителей, включивших уведомления по категории
+func (s *SQLiteStorage) ListSubscribers(ctx context.Context, category string) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT p.user_id FROM profiles p
+JOIN users u ON u.user_id = p.user_id
+WHERE NOT u.unreachable AND NOT u.banned AND ',' || u.notify_categories || ',' LIKE '%,' || ? || ',%'`, category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var uid int64
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		out = append(out, uid)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStorage) GetGroupChat(ctx context.Context, chatID int64) (*GroupChat, error) {
+	var g GroupChat
+	var updated sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT chat_id, title, bot_status, updated_at FROM group_chats WHERE chat_id=?`, chatID).
+		Scan(&g.ChatID, &g.Title, &g.BotStatus, &updated)
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+	g.UpdatedAt = unixTime(updated)
+	return &g, nil
+}
+
+func (s *SQLiteStorage) SaveGroupChat(ctx context.Context, g GroupChat) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO group_chats (chat_id, title, bot_status, updated_at) VALUES (?,?,?,?)
+ON CONFLICT (chat_id) DO UPDATE SET title=excluded.title, bot_status=excluded.bot_status, updated_at=excluded.updated_at`,
+		g.ChatID, g.Title, g.BotStatus, g.UpdatedAt.Unix())
+	return err
+}
+
+func (s *SQLiteStorage) SetGroupMember(ctx context.Context, chatID, userID int64, status string) error {
+	if status == "left" || status == "kicked" {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM group_members WHERE chat_id=? AND user_id=?`, chatID, userID)
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO group_members (chat_id, user_id, status, updated_at) VALUES (?,?,?,unixepoch())
+ON CONFLICT (chat_id, user_id) DO UPDATE SET status=excluded.status, updated_at=excluded.updated_at`, chatID, userID, status)
+	return err
+}
+
+func (s *SQLiteStorage) ListSearchableProfiles(ctx context.Context, limit int) ([]Profile, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT p.user_id, COALESCE(p.username, ''), COALESCE(p.description, ''), COALESCE(p.photo_file_id, '') FROM profiles p
+LEFT JOIN users u ON u.user_id = p.user_id
+WHERE NOT COALESCE(u.hidden_from_search, FALSE) AND NOT COALESCE(u.banned, FALSE)
+ORDER BY p.updated_at DESC
+LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Profile
+	for rows.Next() {
+		var pr Profile
+		if err := rows.Scan(&pr.UserID, &pr.Username, &pr.Description, &pr.PhotoFileID); err != nil {
+			return nil, err
+		}
+		out = append(out, pr)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStorage) CreateOrder(ctx context.Context, o Order, notices func(Order) []OutboxMessage) (int64, error) {
+	// «одна активная анкета» обеспечивает уникальный индекс orders_one_active_per_creator
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.ensureUser(ctx, tx, o.CreatorID); err != nil {
+			return err
+		}
+		err := tx.QueryRowContext(ctx, `INSERT INTO orders (creator_id, category, text, photo_file_id) VALUES (?,?,?,?) RETURNING id`,
+			o.CreatorID, o.Category, o.Text, o.PhotoFileID).Scan(&o.ID)
+		if err != nil {
+			return err
+		}
+		if notices != nil {
+			return s.insertOutbox(ctx, tx, notices(o))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, mapSQLiteError(err)
+	}
+	return o.ID, nil
+}
+
+// sqliteOrderColumns — колонки анкеты в порядке scanOrder
+const sqliteOrderColumns = `id, creator_id, category, COALESCE(text, ''), COALESCE(photo_file_id, ''), complaints`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOrder(r rowScanner) (Order, error) {
+	var o Order
+	err := r.Scan(&o.ID, &o.CreatorID, &o.Category, &o.Text, &o.PhotoFileID, &o.Complaints)
+	return o, err
+}
+
+func (s *SQLiteStorage) GetOrderByCreator(ctx context.Context, userID int64) (*Order, error) {
+	o, err := scanOrder(s.db.QueryRowContext(ctx, `SELECT `+sqliteOrderColumns+` FROM orders WHERE creator_id=? AND status='active'`, userID))
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+	return &o, nil
+}
+
+func (s *SQLiteStorage) GetOrderByID(ctx context.Context, id int64) (*Order, error) {
+	o, err := scanOrder(s.db.QueryRowContext(ctx, `SELECT `+sqliteOrderColumns+` FROM orders WHERE id=? AND status='active'`, id))
+	if err != nil {
+		return nil, mapSQLiteError(err)
+	}
+	return &o, nil
+}
+
+func (s *SQLiteStorage) DeleteOrderByID(ctx context.Context, id int64, notices ...OutboxMessage) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE orders SET status='closed', closed_at=unixepoch() WHERE id=? AND status='active'`, id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrNotFound
+		}
+		return s.insertOutbox(ctx, tx, notices)
+	})
+}
+
+func (s *SQLiteStorage) UpdateOrder(ctx context.Context, o Order) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE orders SET category=?, text=?, photo_file_id=? WHERE id=? AND status='active'`,
+		o.Category, o.Text, o.PhotoFileID, o.ID)
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	// анкету закрыли, пока её редактировали
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) IncrementComplaint(ctx context.Context, orderID int64, reporterID int64) (int, error) {
+	var banned bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE user_id=? AND banned)`, reporterID).Scan(&banned)
+	if err != nil {
+		return 0, err
+	}
+	if banned {
+		return 0, ErrBanned
+	}
+	var c int
+	err = s.db.QueryRowContext(ctx, `UPDATE orders SET complaints = complaints + 1 WHERE id=? AND status='active' RETURNING complaints`, orderID).Scan(&c)
+	return c, mapSQLiteError(err)
+}
+
+func (s *SQLiteStorage) ListOrdersByCategory(ctx context.Context, cat string) ([]Order, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sqliteOrderColumns+` FROM orders WHERE category=? AND status='active' ORDER BY created_at, id`, cat)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Order
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStorage) OrderStats(ctx context.Context) ([]OrderStats, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT category, COUNT(*), COALESCE(SUM(complaints), 0) FROM orders WHERE status='active' GROUP BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byCat := map[string]*OrderStats{}
+	for rows.Next() {
+		var st OrderStats
+		if err := rows.Scan(&st.Category, &st.Orders, &st.Complaints); err != nil {
+			return nil, err
+		}
+		byCat[st.Category] = &st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return withAllCategories(byCat), nil
+}
+
+// insertOutbox пишет сообщения в outbox внутри транзакции; дубликаты DedupKey пропускаются
+func (s *SQLiteStorage) insertOutbox(ctx context.Context, tx *sql.Tx, msgs []OutboxMessage) error {
+	for _, m := range msgs {
+		_, err := tx.ExecContext(ctx, `INSERT INTO outbox (dedup_key, chat_id, text, photo_file_id, parse_mode, reply_markup)
+VALUES (?,?,?,?,?,?) ON CONFLICT (dedup_key) DO NOTHING`,
+			m.DedupKey, m.ChatID, m.Text, m.PhotoFileID, m.ParseMode, m.ReplyMarkup)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) EnqueueOutbox(ctx context.Context, msgs ...OutboxMessage) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return s.insertOutbox(ctx, tx, msgs)
+	})
+}
+
+// ClaimOutbox арендует пачку неотправленных сообщений; реплика одна, так что
+// SKIP LOCKED не нужен
+func (s *SQLiteStorage) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	rows, err := s.db.QueryContext(ctx, `UPDATE outbox SET attempts = attempts + 1, locked_until = unixepoch() + ?
+WHERE id IN (
+	SELECT id FROM outbox
+	WHERE sent_at IS NULL AND failed_at IS NULL AND (locked_until IS NULL OR locked_until < unixepoch())
+	ORDER BY id LIMIT ?
+)
+RETURNING id, dedup_key, chat_id, text, photo_file_id, parse_mode, reply_markup, attempts`, int64(lease.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.DedupKey, &m.ChatID, &m.Text, &m.PhotoFileID, &m.ParseMode, &m.ReplyMarkup, &m.Attempts); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ID < out[b].ID })
+	return out, rows.Err()
+}
+
+func (s *SQLiteStorage) MarkOutboxSent(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox SET sent_at = unixepoch(), locked_until = NULL WHERE id=?`, id)
+	return err
+}
+
+func (s *SQLiteStorage) MarkOutboxFailed(ctx context.Context, id int64, reason string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE outbox SET failed_at = unixepoch(), last_error = ?, locked_until = NULL WHERE id=?`, reason, id)
+	return err
+}
+
+func (s *SQLiteStorage) MarkUpdateSeen(ctx context.Context, updateID int) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `INSERT INTO seen_updates (update_id) VALUES (?) ON CONFLICT DO NOTHING`, updateID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (s *SQLiteStorage) ForgetUpdate(ctx context.Context, updateID int) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM seen_updates WHERE update_id=?`, updateID)
+	return err
+}
+
+func (s *SQLiteStorage) PruneSeenUpdates(ctx context.Context, olderThan time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM seen_updates WHERE seen_at < unixepoch() - ?`, int64(olderThan.Seconds()))
+	return err
+}
+
+func (s *SQLiteStorage) PruneOutbox(ctx context.Context, olderThan time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM outbox WHERE sent_at < unixepoch() - ?1 OR failed_at < unixepoch() - ?1`, int64(olderThan.Seconds()))
+	return err
+}
+
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// sqliteMigrator — migrator для SQLite. Отдельная блокировка не нужна: база
+// принадлежит одному процессу, а запись в файл SQLite сериализует сама.
+type sqliteMigrator struct {
+	db *sql.DB
+}
+
+func (m *sqliteMigrator) dialect() string { return "sqlite" }
+
+func (m *sqliteMigrator) lock(ctx context.Context) (func(), error) {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at INTEGER NOT NULL DEFAULT (unixepoch())
+)`)
+	return func() {}, err
+}
+
+func (m *sqliteMigrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at sql.NullInt64
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		out[v] = unixTime(at)
+	}
+	return out, rows.Err()
+}
+
+func (m *sqliteMigrator) apply(ctx context.Context, mg migration, up bool) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if up {
+		if _, err := tx.ExecContext(ctx, mg.Up); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_version (version, name) VALUES (?, ?)`, mg.Version, mg.Name)
+	} else {
+		if _, err := tx.ExecContext(ctx, mg.Down); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_version WHERE version=?`, mg.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
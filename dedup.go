@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ------------------------ Update deduplication ------------------------
+// Telegram повторяет доставку вебхука, если ответ был медленным или с ошибкой,
+// и тот же update_id приходит ещё раз. Недавние update_id хранятся в
+// ограниченном кольце в памяти; при нескольких репликах за кольцом стоит
+// таблица seen_updates в Postgres, чтобы повтор, пришедший в другую реплику,
+// тоже отбрасывался.
+
+const (
+	seenUpdatesSize = 10000
+	seenUpdatesTTL  = 24 * time.Hour // Telegram хранит неподтверждённые апдейты не дольше суток
+)
+
+// seenUpdateTimeout ограничивает запрос к seen_updates: вебхук не должен ждать
+// медленную базу дольше, чем Telegram ждёт ответа
+var seenUpdateTimeout = 2 * time.Second
+
+type seenSet struct {
+	mu   sync.Mutex
+	ring []int
+	next int
+	// id → его место в кольце. В кольце может остаться id, убранный forget и
+	// добавленный снова в другое место; вытеснение старого места его не трогает.
+	ids map[int]int
+}
+
+func newSeenSet(size int) *seenSet {
+	return &seenSet{ring: make([]int, 0, size), ids: make(map[int]int, size)}
+}
+
+// add запоминает id и возвращает false, если он уже был; самый старый id вытесняется
+func (s *seenSet) add(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if len(s.ring) < cap(s.ring) {
+		s.ids[id] = len(s.ring)
+		s.ring = append(s.ring, id)
+		return true
+	}
+	if old := s.ring[s.next]; s.ids[old] == s.next {
+		delete(s.ids, old)
+	}
+	s.ring[s.next] = id
+	s.ids[id] = s.next
+	s.next = (s.next + 1) % len(s.ring)
+	return true
+}
+
+// forget убирает id, чтобы повторная доставка была обработана; место в кольце
+// остаётся занятым до вытеснения
+func (s *seenSet) forget(id int) {
+	s.mu.Lock()
+	delete(s.ids, id)
+	s.mu.Unlock()
+}
+
+var seenUpdates = newSeenSet(seenUpdatesSize)
+
+// markUpdateSeen возвращает false для уже обработанного update_id. При ошибке
+// или таймауте хранилища решает только кольцо в памяти: лучше редкий дубль
+// в другой реплике, чем потерянный апдейт.
+//
+// Апдейт помечается до обработки, а Telegram получает 200 сразу после
+// постановки в очередь. Если процесс упадёт между этим и концом обработки,
+// апдейт потерян: повтор не придёт, а пришедший был бы отброшен как дубль.
+// Это осознанный выбор в пользу быстрого ответа вебхуку; при штатной
+// остановке очередь дочитывается (см. stopWorkers).
+func markUpdateSeen(ctx context.Context, updateID int) bool {
+	if !seenUpdates.add(updateID) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, seenUpdateTimeout)
+	defer cancel()
+	fresh, err := storage.MarkUpdateSeen(ctx, updateID)
+	if err != nil {
+		slog.Error("mark update seen", slog.Int("update_id", updateID), slog.Any("err", err))
+		return true
+	}
+	return fresh
+}
+
+// forgetUpdate откатывает markUpdateSeen, если апдейт не удалось поставить в очередь
+func forgetUpdate(ctx context.Context, updateID int) {
+	seenUpdates.forget(updateID)
+	ctx, cancel := context.WithTimeout(ctx, seenUpdateTimeout)
+	defer cancel()
+	if err := storage.ForgetUpdate(ctx, updateID); err != nil {
+		slog.Error("forget update", slog.Int("update_id", updateID), slog.Any("err", err))
+	}
+}
+
+// startStorageCleaner раз в час удаляет устаревшие seen_updates и записи outbox,
+// пока не отменён ctx
+func startStorageCleaner(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(time.Hour)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			pruneCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			if err := storage.PruneSeenUpdates(pruneCtx, seenUpdatesTTL); err != nil {
+				slog.Error("prune seen updates", slog.Any("err", err))
+			}
+			if err := storage.PruneOutbox(pruneCtx, outboxRetention); err != nil {
+				slog.Error("prune outbox", slog.Any("err", err))
+			}
+			cancel()
+		}
+	}()
+}
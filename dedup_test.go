@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSeenSetForgetThenReadd(t *testing.T) {
+	s := newSeenSet(3)
+	for _, id := range []int{1, 2, 3} {
+		if !s.add(id) {
+			t.Fatalf("add(%d) = false on first sight", id)
+		}
+	}
+	// 503: апдейт 2 не поставлен в очередь, Telegram присылает его снова;
+	// повтор занимает новое место в кольце (вытесняя 1)
+	s.forget(2)
+	if !s.add(2) {
+		t.Fatal("add(2) after forget = false, want true")
+	}
+	// вытесняется старое место 2; новая запись о 2 должна остаться
+	if !s.add(4) {
+		t.Fatal("add(4) = false")
+	}
+	if s.add(2) {
+		t.Fatal("duplicate of re-added update 2 was let through")
+	}
+}
+
+func TestSeenSetEviction(t *testing.T) {
+	s := newSeenSet(2)
+	s.add(1)
+	s.add(2)
+	s.add(3) // вытесняет 1
+	if !s.add(1) {
+		t.Fatal("evicted id 1 still reported as seen")
+	}
+	if s.add(3) {
+		t.Fatal("id 3 forgotten too early")
+	}
+}
+
+// seenStorage — хранилище, у которого seen_updates зависает или падает
+type seenStorage struct {
+	Storage
+	hang bool
+}
+
+func (s seenStorage) MarkUpdateSeen(ctx context.Context, updateID int) (bool, error) {
+	if s.hang {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return false, errors.New("connection refused")
+}
+
+func TestMarkUpdateSeenStorageFallback(t *testing.T) {
+	defer func(s Storage, d time.Duration, set *seenSet) {
+		storage, seenUpdateTimeout, seenUpdates = s, d, set
+	}(storage, seenUpdateTimeout, seenUpdates)
+	seenUpdateTimeout = 50 * time.Millisecond
+
+	for _, hang := range []bool{true, false} {
+		storage = seenStorage{hang: hang}
+		seenUpdates = newSeenSet(10)
+		start := time.Now()
+		if !markUpdateSeen(context.Background(), 1) {
+			t.Fatalf("hang=%v: fresh update dropped on storage failure", hang)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("hang=%v: markUpdateSeen waited %v", hang, d)
+		}
+		// кольцо в памяти по-прежнему отбрасывает повтор
+		if markUpdateSeen(context.Background(), 1) {
+			t.Fatalf("hang=%v: duplicate let through", hang)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ------------------------ Domain errors ------------------------
+// Оба хранилища возвращают одни и те же ошибки, чтобы обработчики отличали
+// «нет такой записи» или «так нельзя» от недоступной базы. Всё, что не
+// сводится к errors.Is с одной из них, — инфраструктурный сбой.
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict — запись противоречит текущему состоянию: анкету закрыли,
+	// пока её редактировали, или данные нарушают правила схемы
+	ErrConflict = errors.New("conflict")
+	ErrBanned   = errors.New("user is banned")
+)
+
+// Уточнения общих ошибок для нарушений конкретных ограничений схемы
+var (
+	ErrActiveOrderExists = fmt.Errorf("%w: creator already has an active order", ErrAlreadyExists)
+	ErrInvalidCategory   = fmt.Errorf("%w: unknown order category", ErrConflict)
+	ErrOrderTextTooLong  = fmt.Errorf("%w: order text too long", ErrConflict)
+	ErrUnknownUser       = fmt.Errorf("%w: unknown user", ErrConflict)
+)
+
+// Коды SQLSTATE нарушений ограничений
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+)
+
+// constraintErrors сопоставляет имена ограничений из миграций доменным ошибкам
+var constraintErrors = map[string]error{
+	"orders_one_active_per_creator": ErrActiveOrderExists,
+	"orders_category_check":         ErrInvalidCategory,
+	"orders_text_length_check":      ErrOrderTextTooLong,
+	"orders_creator_fk":             ErrUnknownUser,
+	"profiles_user_fk":              ErrUnknownUser,
+}
+
+// mapPgError переводит ошибки Postgres в доменные: отсутствие строки — в
+// ErrNotFound, нарушение ограничения — в его ошибку или общую по коду SQLSTATE
+func mapPgError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	if domainErr, ok := constraintErrors[pgErr.ConstraintName]; ok {
+		return domainErr
+	}
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, pgErr.ConstraintName)
+	case pgForeignKeyViolation, pgCheckViolation:
+		return fmt.Errorf("%w: %s", ErrConflict, pgErr.ConstraintName)
+	}
+	return err
+}
+
+// validateOrder — те же проверки, что CHECK-ограничения orders
+func validateOrder(o Order) error {
+	known := false
+	for _, c := range categories {
+		if c == o.Category {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return ErrInvalidCategory
+	}
+	if utf8.RuneCountInString(o.Text) > maxCardTextLen {
+		return ErrOrderTextTooLong
+	}
+	return nil
+}
@@ -1,36 +1,138 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // ------------------------ Worker pool ------------------------
-var updatesChan = make(chan *tgbot.Update, 100)
-var messagesChan = make(chan tgbot.Chattable, 100)
-
-func startWorkers(b *Bot, updateWorkers int, msgWorkers int) {
-	for i := 0; i < updateWorkers; i++ {
-		go func() {
-			for upd := range updatesChan {
-				processUpdate(b, upd)
+// Очереди создаются в startWorkers с размерами из конфига.
+var (
+	updatesChan  chan *tgbot.Update
+	messagesChan chan tgbot.Chattable
+)
+
+var (
+	updateWorkersWG sync.WaitGroup
+	sendWorkersWG   sync.WaitGroup
+)
+
+// ingress защищает updatesChan от записи после закрытия при остановке
+var ingress struct {
+	sync.RWMutex
+	closed bool
+}
+
+// startWorkers запускает воркеры; ctx — контекст всей работы воркеров,
+// его отмена прерывает обработку апдейтов и отправку сообщений
+func startWorkers(ctx context.Context, b *Bot, cfg Config) {
+	updateTimeout = cfg.UpdateTimeout
+	updatesChan = make(chan *tgbot.Update, cfg.UpdateQueueSize)
+	messagesChan = make(chan tgbot.Chattable, cfg.SendQueueSize)
+	outbound = newOutboundSender(b, cfg.SendWorkers, cfg.SendQueueSize, cfg.DeadLetterPath)
+	// апдейты одного пользователя идут по порядку через его шард
+	dispatcher := newUpdateDispatcher(cfg.UpdateWorkers, cfg.ShardQueueSize, func(upd *tgbot.Update) {
+		processUpdate(ctx, b, upd)
+	})
+	updateWorkersWG.Add(1)
+	go func() {
+		defer updateWorkersWG.Done()
+		dispatcher.run(updatesChan)
+	}()
+	// исходящие раскладываются по очередям чатов; ожидание лимитов одного
+	// чата не задерживает остальные
+	sendWorkersWG.Add(1)
+	go func() {
+		defer sendWorkersWG.Done()
+		for msg := range messagesChan {
+			// ошибка отправки уже записана в dead-letter лог
+			if err := outbound.Submit(ctx, msg, nil); err != nil {
+				return
 			}
-		}()
+		}
+	}()
+}
+
+// stopWorkers закрывает очередь апдейтов, дожидается её разбора, затем так же
+// дренирует очередь исходящих (её пишут только обработчики апдейтов) и очереди чатов.
+// Dead-letter лог закрывается и при таймауте: запоздавшие записи уйдут в stderr.
+func stopWorkers(ctx context.Context) (err error) {
+	defer func() {
+		if cErr := outbound.closeDeadLetter(); cErr != nil {
+			err = errors.Join(err, fmt.Errorf("close dead-letter log: %w", cErr))
+		}
+	}()
+	ingress.Lock()
+	ingress.closed = true
+	close(updatesChan)
+	ingress.Unlock()
+	if err := waitWG(ctx, &updateWorkersWG); err != nil {
+		return fmt.Errorf("update workers: %w", err)
 	}
-	for i := 0; i < msgWorkers; i++ {
-		go func() {
-			for msg := range messagesChan {
-				b.Send(msg)
-			}
-		}()
+	close(messagesChan)
+	if err := waitWG(ctx, &sendWorkersWG); err != nil {
+		return fmt.Errorf("send workers: %w", err)
+	}
+	if err := outbound.wait(ctx); err != nil {
+		return fmt.Errorf("chat send queues: %w", err)
+	}
+	return nil
+}
+
+func waitWG(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryEnqueueUpdate кладёт апдейт в очередь без ожидания; false — очередь
+// переполнена или уже закрыта
+func tryEnqueueUpdate(upd *tgbot.Update) bool {
+	ingress.RLock()
+	defer ingress.RUnlock()
+	if ingress.closed {
+		return false
+	}
+	select {
+	case updatesChan <- upd:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueUpdate ждёт места в очереди (backpressure для long polling)
+func enqueueUpdate(ctx context.Context, upd *tgbot.Update) bool {
+	ingress.RLock()
+	defer ingress.RUnlock()
+	if ingress.closed {
+		return false
+	}
+	select {
+	case updatesChan <- upd:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
@@ -45,10 +147,17 @@ var inFlight = struct {
 	m  map[int64]userState
 }{m: map[int64]userState{}}
 
-func startInFlightCleaner() {
+// startInFlightCleaner удаляет состояния диалогов старше 15 минут, пока не отменён ctx
+func startInFlightCleaner(ctx context.Context) {
 	go func() {
+		t := time.NewTicker(5 * time.Minute)
+		defer t.Stop()
 		for {
-			time.Sleep(5 * time.Minute)
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
 			inFlight.mu.Lock()
 			now := time.Now()
 			for uid, s := range inFlight.m {
@@ -61,6 +170,24 @@ func startInFlightCleaner() {
 	}()
 }
 
+func getUserState(uid int64) string {
+	inFlight.mu.Lock()
+	defer inFlight.mu.Unlock()
+	return inFlight.m[uid].state
+}
+
+func setUserState(uid int64, state string) {
+	inFlight.mu.Lock()
+	inFlight.m[uid] = userState{state, time.Now()}
+	inFlight.mu.Unlock()
+}
+
+func clearUserState(uid int64) {
+	inFlight.mu.Lock()
+	delete(inFlight.m, uid)
+	inFlight.mu.Unlock()
+}
+
 // ------------------------ Webhook ------------------------
 func makeWebhookHandler(b *Bot) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -71,16 +198,51 @@ func makeWebhookHandler(b *Bot) http.HandlerFunc {
 			w.WriteHeader(400)
 			return
 		}
-		updatesChan <- &upd
+		countUpdate(&upd)
+		if !markUpdateSeen(r.Context(), upd.UpdateID) {
+			// повторная доставка уже принятого апдейта
+			w.WriteHeader(200)
+			return
+		}
+		if !tryEnqueueUpdate(&upd) {
+			// Telegram повторит доставку апдейта позже
+			forgetUpdate(r.Context(), upd.UpdateID)
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(200)
 	}
 }
 
-func processUpdate(b *Bot, upd *tgbot.Update) {
-	if upd.Message != nil {
-		handleMessage(b, upd.Message)
-	} else if upd.CallbackQuery != nil {
-		handleCallback(b, upd.CallbackQuery)
+// updateTimeout ограничивает обработку одного апдейта, включая запросы к хранилищу
+var updateTimeout = 30 * time.Second
+
+func processUpdate(ctx context.Context, b *Bot, upd *tgbot.Update) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, updateTimeout)
+	defer cancel()
+	ctx, ul := withUpdateLog(ctx, upd)
+	defer ul.done(ctx, start)
+	defer observeUpdate(upd, start)
+	defer recoverUpdate(ctx, b, upd)
+	if quarantined(updateKey(upd)) {
+		dropQuarantined(ctx, upd)
+		return
+	}
+	switch {
+	case upd.Message != nil:
+		logger(ctx).Debug("message received", redact(upd.Message.Text))
+		handleMessage(ctx, b, upd.Message)
+	case upd.EditedMessage != nil:
+		logger(ctx).Debug("message edited", redact(upd.EditedMessage.Text))
+		handleEditedMessage(ctx, b, upd.EditedMessage)
+	case upd.CallbackQuery != nil:
+		handleCallback(ctx, b, upd.CallbackQuery)
+	case upd.MyChatMember != nil:
+		handleMyChatMember(ctx, b, upd.MyChatMember)
+	case upd.ChatMember != nil:
+		handleChatMember(ctx, upd.ChatMember)
 	}
 }
 
@@ -93,96 +255,72 @@ func sendText(b *Bot, chatID int64, text string) {
 	sendMessage(tgbot.NewMessage(chatID, text))
 }
 
-// ------------------------ Keyboards ------------------------
-func startKeyboard() tgbot.ReplyKeyboardMarkup {
-	return tgbot.NewReplyKeyboard(
-		tgbot.NewKeyboardButtonRow(
-			tgbot.NewKeyboardButton("👷 Исполнитель"),
-			tgbot.NewKeyboardButton("🧑 Клиент"),
-		),
-	)
-}
-
-func profileOptionsKeyboard() tgbot.ReplyKeyboardMarkup {
-	return tgbot.NewReplyKeyboard(
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("🔄 Редактировать профиль")),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("🗑 Удалить профиль")),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("🎨 Дизайн")),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("💻 Программирование")),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("✍️ Контент")),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("↩️ Назад")),
-	)
-}
-
-func orderOptionsKeyboard(category string) tgbot.ReplyKeyboardMarkup {
-	return tgbot.NewReplyKeyboard(
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("🔄 Редактировать анкету")),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("🗑 Удалить анкету")),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton(categoryEmoji(category) + " " + category)),
-		tgbot.NewKeyboardButtonRow(tgbot.NewKeyboardButton("↩️ Назад")),
-	)
-}
-
-func categoryEmoji(cat string) string {
-	switch cat {
-	case "design":
-		return "🎨"
-	case "programming":
-		return "💻"
-	default:
-		return "✍️"
-	}
-}
-
 // ------------------------ Message handlers ------------------------
-func handleMessage(b *Bot, msg *tgbot.Message) {
+func handleMessage(ctx context.Context, b *Bot, msg *tgbot.Message) {
 	chatID := msg.Chat.ID
 	uid := msg.From.ID
+	lang := userLang(ctx, msg.From)
 
 	text := strings.TrimSpace(msg.Text)
 
 	// Команды
 	if msg.IsCommand() {
+		setRoute(ctx, "/"+msg.Command())
 		switch msg.Command() {
 		case "start":
-			sendText(b, chatID, "Выберите роль:")
-			sendMessage(tgbot.NewMessage(chatID, "Выберите роль:"))
+			clearUserState(uid)
+			showMenu(b, chatID, lang, T(lang, "start.choose_role"), startMenu())
 			return
 		case "my_profile":
-			p, err := storage.GetProfile(uid)
-			if err != nil || p == nil {
-				sendText(b, chatID, "Профиль не найден.")
+			p, err := storage.GetProfile(ctx, uid)
+			if err != nil {
+				sendText(b, chatID, T(lang, errorKey(ctx, err, "profile.not_found")))
 				return
 			}
-			sendProfileToChat(b, chatID, *p)
-			sendMessage(tgbot.NewMessage(chatID, "Выберите опцию:", profileOptionsKeyboard()))
+			sendProfileToChat(b, chatID, lang, *p)
+			showMenu(b, chatID, lang, T(lang, "menu.choose_option"), profileMenu())
 			return
 		case "delete_order":
-			if err := deleteOrderByCreator(uid); err != nil {
-				sendText(b, chatID, "У вас нет активной анкеты.")
+			if err := deleteOrderByCreator(ctx, uid); err != nil {
+				sendText(b, chatID, T(lang, errorKey(ctx, err, "order.none")))
 			} else {
-				sendText(b, chatID, "Ваша анкета удалена.")
+				sendText(b, chatID, T(lang, "order.deleted"))
 			}
 			return
+		case "language":
+			showMenu(b, chatID, lang, T(lang, "language.choose"), languageMenu())
+			return
+		case "settings":
+			showSettings(b, chatID, lang, loadUser(ctx, uid))
+			return
+		case "ban", "unban":
+			if isAdmin(uid) {
+				handleBanCommand(ctx, b, msg, lang)
+				return
+			}
 		}
 	}
 
-	inFlight.mu.Lock()
-	stateObj, ok := inFlight.m[uid]
-	inFlight.mu.Unlock()
-	state := ""
-	if ok {
-		state = stateObj.state
+	// Нажатия reply-кнопок идут через реестр меню
+	press := menuPress{UserID: uid, ChatID: chatID, From: msg.From, Lang: lang}
+	if text != "" && menus.dispatchText(ctx, b, press, text) {
+		return
 	}
 
+	state := getUserState(uid)
+	setRoute(ctx, stateRoute(state))
+
 	switch {
 	case state == "creating_profile":
 		var photo string
 		if len(msg.Photo) > 0 {
 			photo = msg.Photo[len(msg.Photo)-1].FileID
 		}
-		if len(text) > 100 {
-			sendText(b, chatID, "Описание не должно быть длиннее 100 символов.")
+		if msg.Caption != "" {
+			text = strings.TrimSpace(msg.Caption)
+		}
+		if utf8.RuneCountInString(text) > maxCardTextLen {
+			sendText(b, chatID, T(lang, "profile.too_long", maxCardTextLen))
 			return
 		}
 		prof := Profile{
@@ -191,123 +329,441 @@ func handleMessage(b *Bot, msg *tgbot.Message) {
 			Description: text,
 			PhotoFileID: photo,
 		}
-		storage.CreateOrUpdateProfile(prof)
-		inFlight.mu.Lock()
-		delete(inFlight.m, uid)
-		inFlight.mu.Unlock()
-		sendText(b, chatID, "Профиль сохранен!")
-		sendMessage(tgbot.NewMessage(chatID, "Выберите опцию:", profileOptionsKeyboard()))
-	case strings.HasPrefix(state, "creating_order:"):
-		parts := strings.Split(state, ":")
-		category := parts[1]
-		if len(text) > 100 && len(msg.Photo) == 0 {
-			sendText(b, chatID, "Текст анкеты не должен превышать 100 символов.")
+		if err := storage.CreateOrUpdateProfile(ctx, prof); err != nil {
+			if errors.Is(err, ErrBanned) {
+				clearUserState(uid)
+				sendText(b, chatID, T(lang, "error.banned"))
+				return
+			}
+			logger(ctx).Error("save profile", slog.Any("err", err))
+			sendText(b, chatID, T(lang, "profile.save_failed"))
 			return
 		}
-		ord := Order{
-			CreatorID:   uid,
-			Category:    category,
-			Text:        text,
+		clearUserState(uid)
+		sendText(b, chatID, T(lang, "profile.saved"))
+		sendProfileToChat(b, chatID, lang, prof)
+		showMenu(b, chatID, lang, T(lang, "menu.choose_option"), profileMenu())
+	case strings.HasPrefix(state, "creating_order:"), state == "editing_order":
+		if msg.Caption != "" {
+			text = strings.TrimSpace(msg.Caption)
 		}
+		if utf8.RuneCountInString(text) > maxCardTextLen {
+			sendText(b, chatID, T(lang, "order.too_long", maxCardTextLen))
+			return
+		}
+		var photo string
 		if len(msg.Photo) > 0 {
-			ord.PhotoFileID = msg.Photo[len(msg.Photo)-1].FileID
+			photo = msg.Photo[len(msg.Photo)-1].FileID
 		}
-		if _, err := storage.CreateOrder(ord); err != nil {
-			sendText(b, chatID, "У вас уже есть активная анкета. Удалите её перед созданием новой.")
+		ord, err := saveOrderFromWizard(ctx, uid, state, text, photo)
+		switch {
+		case errors.Is(err, ErrActiveOrderExists):
+			sendText(b, chatID, T(lang, "order.exists"))
+			return
+		case errors.Is(err, ErrOrderTextTooLong):
+			sendText(b, chatID, T(lang, "order.too_long", maxCardTextLen))
+			return
+		case errors.Is(err, ErrBanned):
+			clearUserState(uid)
+			sendText(b, chatID, T(lang, "error.banned"))
+			return
+		case state == "editing_order" && (errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict)):
+			// анкету закрыли, пока её редактировали
+			clearUserState(uid)
+			sendText(b, chatID, T(lang, "order.none"))
+			return
+		case err != nil:
+			logger(ctx).Error("save order", slog.Any("err", err))
+			sendText(b, chatID, T(lang, "error.generic"))
+			return
+		}
+		clearUserState(uid)
+		sendText(b, chatID, T(lang, "order.saved"))
+		sendOrderToChat(b, chatID, lang, ord, nil)
+		showMenu(b, chatID, lang, T(lang, "order.yours"), orderMenu(ord.Category))
+	case strings.HasPrefix(state, "relay:"):
+		target, err := strconv.ParseInt(strings.TrimPrefix(state, "relay:"), 10, 64)
+		if err != nil || text == "" {
+			sendText(b, chatID, T(lang, "relay.prompt"))
 			return
 		}
-		inFlight.mu.Lock()
-		delete(inFlight.m, uid)
-		inFlight.mu.Unlock()
-		sendText(b, chatID, "Анкета создана!")
-		sendMessage(tgbot.NewMessage(chatID, "Ваша анкета:", orderOptionsKeyboard(category)))
+		clearUserState(uid)
+		relayMessage(ctx, b, uid, target, text)
+		sendText(b, chatID, T(lang, "relay.sent"))
 	default:
-		if text == "↩️ Назад" {
-			sendText(b, chatID, "Выберите роль:")
-			sendMessage(tgbot.NewMessage(chatID, "Выберите роль:", startKeyboard()))
+		sendText(b, chatID, T(lang, "hint.start"))
+	}
+}
+
+// stateRoute — имя маршрута для лога без аргументов состояния (relay:<id> -> state:relay)
+func stateRoute(state string) string {
+	if state == "" {
+		return "hint"
+	}
+	if i := strings.IndexByte(state, ':'); i >= 0 {
+		state = state[:i]
+	}
+	return "state:" + state
+}
+
+// saveOrderFromWizard создаёт новую анкету (вместе с её публикацией в outbox)
+// или обновляет существующую
+func saveOrderFromWizard(ctx context.Context, uid int64, state, text, photo string) (Order, error) {
+	if state == "editing_order" {
+		od, err := storage.GetOrderByCreator(ctx, uid)
+		if err != nil {
+			return Order{}, err
+		}
+		od.Text = text
+		od.PhotoFileID = photo
+		return *od, storage.UpdateOrder(ctx, *od)
+	}
+	ord := Order{
+		CreatorID:   uid,
+		Category:    strings.TrimPrefix(state, "creating_order:"),
+		Text:        text,
+		PhotoFileID: photo,
+	}
+	group, subs := publishGroup(ctx, ord.Category), orderSubscribers(ctx, ord)
+	id, err := storage.CreateOrder(ctx, ord, func(o Order) []OutboxMessage {
+		return publicationNotices(o, group, subs)
+	})
+	if err == nil {
+		wakeOutbox()
+	}
+	ord.ID = id
+	return ord, err
+}
+
+// ------------------------ Menu actions ------------------------
+func onRoleExecutor(ctx context.Context, b *Bot, p menuPress) {
+	setUserState(p.UserID, "creating_profile")
+	sendText(b, p.ChatID, T(p.Lang, "profile.prompt", maxCardTextLen))
+}
+
+func onRoleClient(ctx context.Context, b *Bot, p menuPress) {
+	od, err := storage.GetOrderByCreator(ctx, p.UserID)
+	if err == nil {
+		sendOrderToChat(b, p.ChatID, p.Lang, *od, nil)
+		showMenu(b, p.ChatID, p.Lang, T(p.Lang, "order.yours"), orderMenu(od.Category))
+		return
+	}
+	if !errors.Is(err, ErrNotFound) {
+		sendText(b, p.ChatID, T(p.Lang, errorKey(ctx, err, "")))
+		return
+	}
+	showMenu(b, p.ChatID, p.Lang, T(p.Lang, "order.choose_category"), categoriesMenu())
+}
+
+func onCategoryChosen(category string) menuHandler {
+	return func(ctx context.Context, b *Bot, p menuPress) {
+		setUserState(p.UserID, "creating_order:"+category)
+		sendText(b, p.ChatID, T(p.Lang, "order.prompt", maxCardTextLen))
+	}
+}
+
+func onProfileEdit(ctx context.Context, b *Bot, p menuPress) {
+	setUserState(p.UserID, "creating_profile")
+	sendText(b, p.ChatID, T(p.Lang, "profile.prompt_edit", maxCardTextLen))
+}
+
+func onProfileDelete(ctx context.Context, b *Bot, p menuPress) {
+	if err := storage.DeleteProfile(ctx, p.UserID); err != nil {
+		sendText(b, p.ChatID, T(p.Lang, errorKey(ctx, err, "profile.not_found")))
+		return
+	}
+	sendText(b, p.ChatID, T(p.Lang, "profile.deleted"))
+	showMenu(b, p.ChatID, p.Lang, T(p.Lang, "start.choose_role"), startMenu())
+}
+
+// onBrowseCategory показывает последние анкеты категории с кнопками Коннект/Жалоба
+func onBrowseCategory(category string) menuHandler {
+	return func(ctx context.Context, b *Bot, p menuPress) {
+		orders, err := storage.ListOrdersByCategory(ctx, category)
+		if err != nil {
+			sendText(b, p.ChatID, T(p.Lang, "orders.load_failed"))
 			return
 		}
-		sendText(b, chatID, "Нажмите /start, чтобы начать.")
+		shown := 0
+		for _, od := range orders {
+			if od.CreatorID == p.UserID {
+				continue
+			}
+			kb := orderActionsKeyboard(p.Lang, od.ID)
+			sendOrderToChat(b, p.ChatID, p.Lang, od, &kb)
+			if shown++; shown == 10 {
+				break
+			}
+		}
+		if shown == 0 {
+			sendText(b, p.ChatID, T(p.Lang, "orders.empty"))
+		}
 	}
 }
 
-// ------------------------ Callbacks ------------------------
-func handleCallback(b *Bot, q *tgbot.CallbackQuery) {
-	data := q.Data
-	uid := q.From.ID
-	chatID := q.Message.Chat.ID
+func onOrderEdit(ctx context.Context, b *Bot, p menuPress) {
+	if _, err := storage.GetOrderByCreator(ctx, p.UserID); err != nil {
+		sendText(b, p.ChatID, T(p.Lang, errorKey(ctx, err, "order.none")))
+		return
+	}
+	setUserState(p.UserID, "editing_order")
+	sendText(b, p.ChatID, T(p.Lang, "order.prompt_edit", maxCardTextLen))
+}
 
-	b.api.Request(tgbot.NewCallback(q.ID, ""))
+func onOrderDelete(ctx context.Context, b *Bot, p menuPress) {
+	if err := deleteOrderByCreator(ctx, p.UserID); err != nil {
+		sendText(b, p.ChatID, T(p.Lang, errorKey(ctx, err, "order.none")))
+		return
+	}
+	sendText(b, p.ChatID, T(p.Lang, "order.deleted"))
+	showMenu(b, p.ChatID, p.Lang, T(p.Lang, "start.choose_role"), startMenu())
+}
 
-	switch {
-	case data == "role:executor":
-		inFlight.mu.Lock()
-		inFlight.m[uid] = userState{"creating_profile", time.Now()}
-		inFlight.mu.Unlock()
-		sendText(b, int64(uid), "Отправьте текст (0-100 символов) и/или фото для профиля.")
-	case data == "role:client":
-		sendText(b, chatID, "Выберите категорию для анкеты:")
-		msg := tgbot.NewMessage(chatID, "Выберите категорию:")
-		msg.ReplyMarkup = categoriesKeyboard()
-		sendMessage(msg)
-	case strings.HasPrefix(data, "cat:"):
-		category := strings.Split(data, ":")[1]
-		inFlight.mu.Lock()
-		inFlight.m[uid] = userState{"creating_order:" + category, time.Now()}
-		inFlight.mu.Unlock()
-		sendText(b, chatID, "Отправьте текст (0-100 символов) и/или фото для анкеты.")
-	case strings.HasPrefix(data, "order:connect:"):
-		id, _ := strconv.ParseInt(strings.Split(data, ":")[2], 10, 64)
-		handleConnect(b, uid, id)
-	case strings.HasPrefix(data, "order:complain:"):
-		id, _ := strconv.ParseInt(strings.Split(data, ":")[2], 10, 64)
-		btn := tgbot.NewInlineKeyboardMarkup(
-			tgbot.NewInlineKeyboardRow(
-				tgbot.NewInlineKeyboardButtonData("Да, пожаловаться", fmt.Sprintf("complain:confirm:%d", id)),
-				tgbot.NewInlineKeyboardButtonData("Отмена", "complain:cancel"),
-			),
-		)
-		msg := tgbot.NewMessage(chatID, "Вы уверены, что хотите отправить жалобу?")
-		msg.ReplyMarkup = btn
-		sendMessage(msg)
-	case strings.HasPrefix(data, "complain:confirm:"):
-		id, _ := strconv.ParseInt(strings.Split(data, ":")[2], 10, 64)
-		count, err := storage.IncrementComplaint(id, uid)
+// onSearchExecutors показывает клиенту профили исполнителей, не скрывших себя из поиска
+func onSearchExecutors(ctx context.Context, b *Bot, p menuPress) {
+	profiles, err := storage.ListSearchableProfiles(ctx, 10)
+	if err != nil {
+		sendText(b, p.ChatID, T(p.Lang, "error.generic"))
+		return
+	}
+	shown := 0
+	for _, prof := range profiles {
+		if prof.UserID == p.UserID {
+			continue
+		}
+		sendContactCard(ctx, b, p.ChatID, p.Lang, prof)
+		shown++
+	}
+	if shown == 0 {
+		sendText(b, p.ChatID, T(p.Lang, "search.empty"))
+	}
+}
+
+func onBackToStart(ctx context.Context, b *Bot, p menuPress) {
+	showMenu(b, p.ChatID, p.Lang, T(p.Lang, "start.choose_role"), startMenu())
+}
+
+// onLanguageChosen сохраняет явный выбор языка поверх language_code из Telegram
+func onLanguageChosen(lang string) menuHandler {
+	return func(ctx context.Context, b *Bot, p menuPress) {
+		u, err := getUser(ctx, p.UserID)
 		if err != nil {
-			sendText(b, uid, "Ошибка.")
+			sendText(b, p.ChatID, T(p.Lang, "error.generic"))
+			return
+		}
+		u.Language = lang
+		if err := storage.SaveUser(ctx, u); err != nil {
+			sendText(b, p.ChatID, T(p.Lang, "error.generic"))
 			return
 		}
-		sendText(b, uid, fmt.Sprintf("Жалоба принята. Всего: %d", count))
-		if count >= 10 {
-			if od, _ := storage.GetOrderByID(id); od != nil {
-				_ = storage.DeleteOrderByID(id)
-				sendText(b, od.CreatorID, "Ваша анкета удалена из-за 10 жалоб.")
+		sendText(b, p.ChatID, T(lang, "language.set"))
+		showMenu(b, p.ChatID, lang, T(lang, "start.choose_role"), startMenu())
+	}
+}
+
+// ------------------------ Callbacks ------------------------
+func init() {
+	callbacks.handle(callbackRoute{Name: "menu", Args: []cbArgKind{cbString}, Handler: onMenuCallback})
+	callbacks.handle(callbackRoute{Name: "order.connect", Args: []cbArgKind{cbInt64}, Signed: true, Handler: onOrderConnect})
+	callbacks.handle(callbackRoute{Name: "order.complain", Args: []cbArgKind{cbInt64}, Signed: true, Handler: onOrderComplain})
+	callbacks.handle(callbackRoute{Name: "complain.confirm", Args: []cbArgKind{cbInt64}, Signed: true, Handler: onComplainConfirm})
+	callbacks.handle(callbackRoute{Name: "complain.cancel", Handler: onComplainCancel})
+	callbacks.handle(callbackRoute{Name: "relay.start", Args: []cbArgKind{cbInt64}, Signed: true, Handler: onRelayStart})
+}
+
+func handleCallback(ctx context.Context, b *Bot, q *tgbot.CallbackQuery) {
+	route, args, err := callbacks.decode(q.Data)
+	if err != nil {
+		logger(ctx).Warn("callback rejected", slog.String("data", q.Data), slog.Any("err", err))
+		callbacksTotal.WithLabelValues("invalid").Inc()
+		b.api.Request(tgbot.NewCallbackWithAlert(q.ID, T(userLang(ctx, q.From), "callback.invalid")))
+		return
+	}
+	setRoute(ctx, "cb:"+route.Name)
+	callbacksTotal.WithLabelValues(route.Name).Inc()
+	b.api.Request(tgbot.NewCallback(q.ID, ""))
+	route.Handler(ctx, b, q, args)
+}
+
+// callbackChatID — чат, куда отвечать на колбэк. У кнопок под inline-сообщениями
+// (режим inline) Message нет, тогда отвечаем в личку нажавшему.
+func callbackChatID(q *tgbot.CallbackQuery) int64 {
+	if q.Message != nil && q.Message.Chat != nil {
+		return q.Message.Chat.ID
+	}
+	return q.From.ID
+}
+
+func onMenuCallback(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	press := menuPress{UserID: q.From.ID, ChatID: callbackChatID(q), From: q.From, Lang: userLang(ctx, q.From)}
+	if !menus.dispatchCallback(ctx, b, press, args.String(0)) {
+		logger(ctx).Warn("unknown menu item", slog.String("item", args.String(0)))
+	}
+}
+
+func onOrderConnect(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	handleConnect(ctx, b, q.From.ID, userLang(ctx, q.From), args.Int64(0))
+}
+
+func onOrderComplain(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	lang := userLang(ctx, q.From)
+	msg := tgbot.NewMessage(callbackChatID(q), T(lang, "complain.ask"))
+	msg.ReplyMarkup = complainConfirmKeyboard(lang, args.Int64(0))
+	sendMessage(msg)
+}
+
+func onComplainConfirm(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	id, uid, lang := args.Int64(0), q.From.ID, userLang(ctx, q.From)
+	count, err := storage.IncrementComplaint(ctx, id, uid)
+	if err != nil {
+		sendText(b, uid, T(lang, errorKey(ctx, err, "order.not_found")))
+		return
+	}
+	sendText(b, uid, Tn(lang, "complain.accepted", count))
+	if count >= complaintsLimit {
+		if od, _ := storage.GetOrderByID(ctx, id); od != nil {
+			notice := outboxText(fmt.Sprintf("order:%d:removed", id), od.CreatorID,
+				Tn(langOf(ctx, od.CreatorID), "order.removed_complaints", complaintsLimit))
+			if err := storage.DeleteOrderByID(ctx, id, notice); err != nil && !errors.Is(err, ErrNotFound) {
+				logger(ctx).Error("delete order after complaints", slog.Int64("order_id", id), slog.Any("err", err))
+				return
 			}
+			wakeOutbox()
 		}
-	case data == "complain:cancel":
-		sendText(b, uid, "Жалоба отменена.")
 	}
 }
 
+func onComplainCancel(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	sendText(b, q.From.ID, T(userLang(ctx, q.From), "complain.cancelled"))
+}
+
+func onRelayStart(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	setUserState(q.From.ID, "relay:"+strconv.FormatInt(args.Int64(0), 10))
+	sendText(b, q.From.ID, T(userLang(ctx, q.From), "relay.prompt"))
+}
+
 // ------------------------ Orders ------------------------
-func deleteOrderByCreator(userID int64) error {
-	od, err := storage.GetOrderByCreator(userID)
+
+// complaintsLimit — после стольких жалоб анкета удаляется
+const complaintsLimit = 10
+
+// categoryGroups — группы Telegram, куда публикуются анкеты категорий (0 — не публиковать)
+var categoryGroups = map[string]int64{}
+
+type subscriber struct {
+	UserID int64
+	Lang   string
+}
+
+// orderSubscribers возвращает исполнителей, не отключивших уведомления по
+// категории анкеты в /settings. Вызывается до CreateOrder: колбэк notices
+// не может обращаться к storage.
+func orderSubscribers(ctx context.Context, o Order) []subscriber {
+	ids, err := storage.ListSubscribers(ctx, o.Category)
+	if err != nil {
+		logger(ctx).Error("list subscribers", slog.String("category", o.Category), slog.Any("err", err))
+		return nil
+	}
+	subs := make([]subscriber, 0, len(ids))
+	for _, uid := range ids {
+		if uid != o.CreatorID {
+			subs = append(subs, subscriber{UserID: uid, Lang: langOf(ctx, uid)})
+		}
+	}
+	return subs
+}
+
+// publicationNotices — публикация новой анкеты в группу категории (groupID 0 — не публиковать)
+// и рассылка подписчикам
+func publicationNotices(o Order, groupID int64, subs []subscriber) []OutboxMessage {
+	var out []OutboxMessage
+	if groupID != 0 {
+		kb := orderActionsKeyboard(defaultLang, o.ID)
+		out = append(out, outboxCard(fmt.Sprintf("order:%d:publish:%d", o.ID, groupID), groupID,
+			o.PhotoFileID, renderOrder(defaultLang, o), &kb))
+	}
+	for _, s := range subs {
+		kb := orderActionsKeyboard(s.Lang, o.ID)
+		out = append(out, outboxCard(fmt.Sprintf("order:%d:publish:%d", o.ID, s.UserID), s.UserID,
+			o.PhotoFileID, renderOrder(s.Lang, o), &kb))
+	}
+	return out
+}
+
+// errorKey выбирает сообщение об ошибке хранилища: notFound для ErrNotFound
+// (пустой — не ожидается), error.banned для ErrBanned, иначе общую ошибку.
+// Сбои хранилища при этом пишутся в лог.
+func errorKey(ctx context.Context, err error, notFound string) string {
+	switch {
+	case errors.Is(err, ErrNotFound) && notFound != "":
+		return notFound
+	case errors.Is(err, ErrBanned):
+		return "error.banned"
+	}
+	logger(ctx).Error("storage", slog.Any("err", err))
+	return "error.generic"
+}
+
+func deleteOrderByCreator(ctx context.Context, userID int64) error {
+	od, err := storage.GetOrderByCreator(ctx, userID)
 	if err != nil {
 		return err
 	}
-	return storage.DeleteOrderByID(od.ID)
+	return storage.DeleteOrderByID(ctx, od.ID)
 }
 
-func handleConnect(b *Bot, connectorID int64, orderID int64) {
-	od, err := storage.GetOrderByID(orderID)
+func handleConnect(ctx context.Context, b *Bot, connectorID int64, lang string, orderID int64) {
+	od, err := storage.GetOrderByID(ctx, orderID)
 	if err != nil {
-		sendText(b, connectorID, "Анкета не найдена.")
+		sendText(b, connectorID, T(lang, errorKey(ctx, err, "order.not_found")))
+		return
+	}
+	// уведомления автору пишутся в outbox вместе с удалением анкеты
+	creatorLang := langOf(ctx, od.CreatorID)
+	keyPrefix := fmt.Sprintf("order:%d:connect:", orderID)
+	var notices []OutboxMessage
+	if loadUser(ctx, connectorID).RelayOnly() {
+		notices = append(notices, outboxText(keyPrefix+"text", od.CreatorID, T(creatorLang, "connect.accepted_relay")))
+	} else {
+		notices = append(notices, outboxText(keyPrefix+"text", od.CreatorID, T(creatorLang, "connect.accepted_by", connectorID)))
+	}
+	if prof, err := storage.GetProfile(ctx, connectorID); err == nil && prof != nil {
+		text, kb := contactCard(ctx, creatorLang, *prof)
+		notices = append(notices, outboxCard(keyPrefix+"profile", od.CreatorID, prof.PhotoFileID, text, kb))
+	}
+	if err := storage.DeleteOrderByID(ctx, orderID, notices...); err != nil {
+		// ErrNotFound: анкету успел принять кто-то другой
+		sendText(b, connectorID, T(lang, errorKey(ctx, err, "order.not_found")))
 		return
 	}
-	sendText(b, od.CreatorID, fmt.Sprintf("Ваша анкета принята пользователем %d", connectorID))
-	if prof, err := storage.GetProfile(connectorID); err == nil && prof != nil {
-		sendProfileToChat(b, od.CreatorID, *prof)
+	wakeOutbox()
+	sendText(b, connectorID, T(lang, "connect.done"))
+}
+
+// ------------------------ Relay ------------------------
+
+// sendContactCard показывает профиль с учётом видимости контакта владельца:
+// при «только через бота» @username скрывается и добавляется кнопка «Написать»
+func sendContactCard(ctx context.Context, b *Bot, chatID int64, lang string, p Profile) {
+	text, kb := contactCard(ctx, lang, p)
+	sendCard(chatID, p.PhotoFileID, text, kb)
+}
+
+// contactCard рендерит профиль для sendContactCard и outbox
+func contactCard(ctx context.Context, lang string, p Profile) (string, *tgbot.InlineKeyboardMarkup) {
+	if !loadUser(ctx, p.UserID).RelayOnly() {
+		return renderProfile(lang, p), nil
 	}
-	_ = storage.DeleteOrderByID(orderID)
-	sendText(b, connectorID, "Вы успешно сконнектились.")
+	kb := relayKeyboard(lang, p.UserID)
+	p.Username, p.UserID = "", 0
+	return renderProfile(lang, p), &kb
+}
+
+// relayMessage пересылает текст через бота, не раскрывая контакт отправителя;
+// у получателя появляется кнопка ответа
+func relayMessage(ctx context.Context, b *Bot, from, to int64, text string) {
+	lang := langOf(ctx, to)
+	msg := tgbot.NewMessage(to, T(lang, "relay.incoming", text))
+	msg.ReplyMarkup = relayKeyboard(lang, from)
+	sendMessage(msg)
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ------------------------ Health checks ------------------------
+// /livez отвечает, пока процесс жив. /readyz проверяет зависимости и отдаёт
+// статус каждого компонента JSON-ом; 503, если хоть один не в порядке:
+//   - storage — ping пула Postgres или запись в файл JSON-хранилища;
+//   - telegram — недавний успешный вызов API, иначе getMe;
+//   - queues — заполненность updatesChan/messagesChan и остановка приёма.
+
+const (
+	readyTimeout       = 3 * time.Second
+	telegramFreshness  = 5 * time.Minute
+	queueSaturationMax = 0.9
+)
+
+// lastTelegramOK — unix-время последнего успешного запроса к Bot API
+var lastTelegramOK atomic.Int64
+
+func markTelegramOK() {
+	lastTelegramOK.Store(time.Now().Unix())
+}
+
+type componentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Detail any    `json:"detail,omitempty"`
+}
+
+type readyReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentStatus `json:"components"`
+}
+
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(200)
+	w.Write([]byte("ok"))
+}
+
+func makeReadyzHandler(b *Bot) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		rep := readyReport{Status: "ok", Components: map[string]componentStatus{
+			"storage":  check(storage.Ping(ctx), nil),
+			"telegram": checkTelegram(ctx, b),
+			"queues":   checkQueues(),
+		}}
+		code := http.StatusOK
+		for _, c := range rep.Components {
+			if c.Status != "ok" {
+				rep.Status = "fail"
+				code = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(rep)
+	}
+}
+
+func check(err error, detail any) componentStatus {
+	if err != nil {
+		return componentStatus{Status: "fail", Error: err.Error(), Detail: detail}
+	}
+	return componentStatus{Status: "ok", Detail: detail}
+}
+
+// checkTelegram не дёргает API, если недавно был успешный запрос
+func checkTelegram(ctx context.Context, b *Bot) componentStatus {
+	if last := lastTelegramOK.Load(); last != 0 {
+		if age := time.Since(time.Unix(last, 0)); age < telegramFreshness {
+			return check(nil, map[string]any{"last_success_seconds_ago": int(age.Seconds())})
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		// GetMe не принимает ctx, поэтому ждём его не дольше readyTimeout
+		_, err := b.api.GetMe()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			markTelegramOK()
+		}
+		return check(err, map[string]any{"checked": "getMe"})
+	case <-ctx.Done():
+		return check(fmt.Errorf("getMe: %w", ctx.Err()), nil)
+	}
+}
+
+func checkQueues() componentStatus {
+	ingress.RLock()
+	closed := ingress.closed
+	ingress.RUnlock()
+	queues := []struct {
+		name     string
+		len, cap int
+	}{
+		{"updates", len(updatesChan), cap(updatesChan)},
+		{"messages", len(messagesChan), cap(messagesChan)},
+	}
+	detail := map[string]map[string]int{}
+	var err error
+	for _, q := range queues {
+		detail[q.name] = map[string]int{"len": q.len, "cap": q.cap}
+		if err == nil && q.cap > 0 && float64(q.len)/float64(q.cap) >= queueSaturationMax {
+			err = fmt.Errorf("%s queue saturated", q.name)
+		}
+	}
+	if closed {
+		err = fmt.Errorf("shutting down")
+	}
+	return check(err, detail)
+}
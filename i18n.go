@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Locales ------------------------
+const (
+	langRU      = "ru"
+	langEN      = "en"
+	defaultLang = langRU
+)
+
+var supportedLangs = []string{langRU, langEN}
+
+// catalog: язык → ключ → формы сообщения. Обычные сообщения имеют одну форму,
+// сообщения с числом — по одной на каждую форму множественного числа языка
+// (ru: one/few/many, en: one/other), см. pluralIndex.
+var catalog = map[string]map[string][]string{
+	langRU: {
+		// кнопки
+		"btn.executor":        {"👷 Исполнитель"},
+		"btn.client":          {"🧑‍💼 Клиент"},
+		"btn.cat.design":      {"🎨 Дизайн"},
+		"btn.cat.programming": {"💻 Программирование"},
+		"btn.cat.content":     {"📸 Контент-мейкинг"},
+		"btn.profile.edit":    {"✏️ Редактировать профиль"},
+		"btn.profile.delete":  {"🗑️ Удалить профиль"},
+		"btn.order.edit":      {"✏️ Редактировать анкету"},
+		"btn.order.delete":    {"🗑️ Удалить анкету"},
+		"btn.back":            {"🔙 Назад"},
+		"btn.connect":         {"🤝 Коннект"},
+		"btn.complain":        {"⚠️ Пожаловаться"},
+		"btn.complain.yes":    {"Да, пожаловаться"},
+		"btn.cancel":          {"Отмена"},
+		"btn.lang.ru":         {"🇷🇺 Русский"},
+		"btn.lang.en":         {"🇬🇧 English"},
+		"btn.search":          {"👀 Исполнители"},
+		"btn.relay":           {"✉️ Написать"},
+
+		// категории
+		"category.design":      {"Дизайн"},
+		"category.programming": {"Программирование"},
+		"category.content":     {"Контент-мейкинг"},
+
+		// общие
+		"start.choose_role":  {"Выберите роль:"},
+		"menu.choose_option": {"Выберите опцию:"},
+		"hint.start":         {"Нажмите /start, чтобы начать."},
+		"error.generic":      {"Произошла ошибка, попробуйте позже."},
+		"error.internal":     {"Не получилось обработать запрос. Мы уже разбираемся — попробуйте ещё раз позже."},
+		"error.banned":       {"Администратор ограничил вам доступ к боту."},
+		"callback.invalid":   {"Кнопка устарела или повреждена. Нажмите /start."},
+		"language.choose":    {"Выберите язык:"},
+		"language.set":       {"Язык переключён на русский."},
+		"lang.name":          {"Русский"},
+
+		// служебные
+		"admin.group_unavailable": {"⚠️ Бот больше не может писать в группу «%s» (%d), категория %s: статус %s. Анкеты туда не публикуются."},
+		"admin.ban_usage":         {"Использование: /ban <user_id> или /unban <user_id>"},
+		"admin.banned":            {"Пользователь %d заблокирован, его анкета закрыта."},
+		"admin.unbanned":          {"Пользователь %d разблокирован."},
+
+		// настройки
+		"settings.title":            {"⚙️ Настройки. Нажмите на пункт, чтобы изменить его."},
+		"settings.notify":           {"🔔 %s: %s"},
+		"settings.language":         {"🌐 Язык: %s"},
+		"settings.contact_username": {"👤 Контакт: показывать @username"},
+		"settings.contact_relay":    {"👤 Контакт: только через бота"},
+		"settings.search":           {"🔍 Профиль в поиске: %s"},
+
+		// связь через бота
+		"relay.prompt":   {"Напишите сообщение — бот перешлёт его пользователю."},
+		"relay.incoming": {"✉️ Сообщение через бота:\n\n%s"},
+		"relay.sent":     {"Сообщение отправлено."},
+		"search.empty":   {"Пока нет доступных исполнителей."},
+
+		// профиль
+		"profile.prompt":      {"Отправьте текст (0-%d символов) и/или фото для профиля."},
+		"profile.prompt_edit": {"Отправьте новый текст (0-%d символов) и/или фото для профиля."},
+		"profile.too_long":    {"Описание не должно быть длиннее %d символов."},
+		"profile.save_failed": {"Не удалось сохранить профиль, попробуйте позже."},
+		"profile.saved":       {"Профиль сохранен!"},
+		"profile.not_found":   {"Профиль не найден."},
+		"profile.deleted":     {"Профиль удалён."},
+
+		// анкеты
+		"order.choose_category": {"Выберите категорию для анкеты:"},
+		"order.prompt":          {"Отправьте текст (0-%d символов) и/или фото для анкеты."},
+		"order.prompt_edit":     {"Отправьте новый текст (0-%d символов) и/или фото для анкеты."},
+		"order.too_long":        {"Текст анкеты не должен превышать %d символов."},
+		"order.exists":          {"У вас уже есть активная анкета. Удалите её перед созданием новой."},
+		"order.saved":           {"Анкета сохранена!"},
+		"order.yours":           {"Ваша анкета:"},
+		"order.none":            {"У вас нет активной анкеты."},
+		"order.deleted":         {"Ваша анкета удалена."},
+		"order.not_found":       {"Анкета не найдена."},
+		"orders.load_failed":    {"Не удалось загрузить анкеты, попробуйте позже."},
+		"orders.empty":          {"В этой категории пока нет анкет."},
+		"order.removed_complaints": {
+			"Ваша анкета удалена из-за %d жалобы.",
+			"Ваша анкета удалена из-за %d жалоб.",
+			"Ваша анкета удалена из-за %d жалоб.",
+		},
+
+		// жалобы и коннект
+		"complain.ask":       {"Вы уверены, что хотите отправить жалобу?"},
+		"complain.cancelled": {"Жалоба отменена."},
+		"complain.accepted": {
+			"Жалоба принята. Всего на анкете %d жалоба.",
+			"Жалоба принята. Всего на анкете %d жалобы.",
+			"Жалоба принята. Всего на анкете %d жалоб.",
+		},
+		"connect.accepted_by":    {"Ваша анкета принята пользователем %d"},
+		"connect.done":           {"Вы успешно сконнектились."},
+		"connect.accepted_relay": {"Вашу анкету принял исполнитель. Он общается только через бота — нажмите «✉️ Написать» под его профилем."},
+
+		// карточки
+		"card.profile_title": {"👷 Профиль исполнителя"},
+		"card.profile_stats": {"📊 Описание: %d/%d · Фото: %s"},
+		"card.photo_yes":     {"есть"},
+		"card.photo_no":      {"нет"},
+		"card.order_title":   {"Анкета #%d"},
+		"card.category":      {"📂 Категория: %s"},
+		"card.complaints": {
+			"⚠️ %d жалоба",
+			"⚠️ %d жалобы",
+			"⚠️ %d жалоб",
+		},
+	},
+	langEN: {
+		"btn.executor":        {"👷 Freelancer"},
+		"btn.client":          {"🧑‍💼 Client"},
+		"btn.cat.design":      {"🎨 Design"},
+		"btn.cat.programming": {"💻 Programming"},
+		"btn.cat.content":     {"📸 Content making"},
+		"btn.profile.edit":    {"✏️ Edit profile"},
+		"btn.profile.delete":  {"🗑️ Delete profile"},
+		"btn.order.edit":      {"✏️ Edit request"},
+		"btn.order.delete":    {"🗑️ Delete request"},
+		"btn.back":            {"🔙 Back"},
+		"btn.connect":         {"🤝 Connect"},
+		"btn.complain":        {"⚠️ Report"},
+		"btn.complain.yes":    {"Yes, report"},
+		"btn.cancel":          {"Cancel"},
+		"btn.lang.ru":         {"🇷🇺 Русский"},
+		"btn.lang.en":         {"🇬🇧 English"},
+		"btn.search":          {"👀 Freelancers"},
+		"btn.relay":           {"✉️ Message"},
+
+		"category.design":      {"Design"},
+		"category.programming": {"Programming"},
+		"category.content":     {"Content making"},
+
+		"start.choose_role":  {"Choose your role:"},
+		"menu.choose_option": {"Choose an option:"},
+		"hint.start":         {"Press /start to begin."},
+		"error.generic":      {"Something went wrong, please try again later."},
+		"error.internal":     {"We couldn't process your request. We're looking into it, please try again later."},
+		"error.banned":       {"An administrator has restricted your access to the bot."},
+		"callback.invalid":   {"This button is outdated or broken. Press /start."},
+		"language.choose":    {"Choose your language:"},
+		"language.set":       {"Language switched to English."},
+		"lang.name":          {"English"},
+
+		"admin.group_unavailable": {"⚠️ The bot can no longer post to the group \"%s\" (%d), category %s: status %s. Orders are not published there."},
+		"admin.ban_usage":         {"Usage: /ban <user_id> or /unban <user_id>"},
+		"admin.banned":            {"User %d is banned, their request has been closed."},
+		"admin.unbanned":          {"User %d is unbanned."},
+
+		"settings.title":            {"⚙️ Settings. Tap an option to change it."},
+		"settings.notify":           {"🔔 %s: %s"},
+		"settings.language":         {"🌐 Language: %s"},
+		"settings.contact_username": {"👤 Contact: show @username"},
+		"settings.contact_relay":    {"👤 Contact: via the bot only"},
+		"settings.search":           {"🔍 Profile in search: %s"},
+
+		"relay.prompt":   {"Write a message and the bot will forward it."},
+		"relay.incoming": {"✉️ Message via the bot:\n\n%s"},
+		"relay.sent":     {"Message sent."},
+		"search.empty":   {"No freelancers available yet."},
+
+		"profile.prompt":      {"Send a text (0-%d characters) and/or a photo for your profile."},
+		"profile.prompt_edit": {"Send a new text (0-%d characters) and/or a photo for your profile."},
+		"profile.too_long":    {"The description must not be longer than %d characters."},
+		"profile.save_failed": {"Could not save the profile, please try again later."},
+		"profile.saved":       {"Profile saved!"},
+		"profile.not_found":   {"Profile not found."},
+		"profile.deleted":     {"Profile deleted."},
+
+		"order.choose_category": {"Choose a category for your request:"},
+		"order.prompt":          {"Send a text (0-%d characters) and/or a photo for your request."},
+		"order.prompt_edit":     {"Send a new text (0-%d characters) and/or a photo for your request."},
+		"order.too_long":        {"The request text must not exceed %d characters."},
+		"order.exists":          {"You already have an active request. Delete it before creating a new one."},
+		"order.saved":           {"Request saved!"},
+		"order.yours":           {"Your request:"},
+		"order.none":            {"You have no active request."},
+		"order.deleted":         {"Your request has been deleted."},
+		"order.not_found":       {"Request not found."},
+		"orders.load_failed":    {"Could not load requests, please try again later."},
+		"orders.empty":          {"There are no requests in this category yet."},
+		"order.removed_complaints": {
+			"Your request was removed after %d complaint.",
+			"Your request was removed after %d complaints.",
+		},
+
+		"complain.ask":       {"Are you sure you want to report this request?"},
+		"complain.cancelled": {"Report cancelled."},
+		"complain.accepted": {
+			"Report received. The request has %d complaint.",
+			"Report received. The request has %d complaints.",
+		},
+		"connect.accepted_by":    {"Your request was accepted by user %d"},
+		"connect.done":           {"You are connected."},
+		"connect.accepted_relay": {"A freelancer accepted your request. They talk via the bot only — tap «✉️ Message» under their profile."},
+
+		"card.profile_title": {"👷 Freelancer profile"},
+		"card.profile_stats": {"📊 Description: %d/%d · Photo: %s"},
+		"card.photo_yes":     {"yes"},
+		"card.photo_no":      {"no"},
+		"card.order_title":   {"Request #%d"},
+		"card.category":      {"📂 Category: %s"},
+		"card.complaints": {
+			"⚠️ %d complaint",
+			"⚠️ %d complaints",
+		},
+	},
+}
+
+// T возвращает перевод ключа; при отсутствии — из языка по умолчанию, иначе сам ключ
+func T(lang, key string, args ...any) string {
+	forms := lookup(lang, key)
+	if forms == nil {
+		return key
+	}
+	if len(args) == 0 {
+		return forms[0]
+	}
+	return fmt.Sprintf(forms[0], args...)
+}
+
+// Tn выбирает форму множественного числа для n и подставляет n в сообщение
+func Tn(lang, key string, n int) string {
+	forms := lookup(lang, key)
+	if forms == nil {
+		return key
+	}
+	i := pluralIndex(lang, n)
+	if i >= len(forms) {
+		i = len(forms) - 1
+	}
+	return fmt.Sprintf(forms[i], n)
+}
+
+func lookup(lang, key string) []string {
+	if forms, ok := catalog[lang][key]; ok {
+		return forms
+	}
+	if forms, ok := catalog[defaultLang][key]; ok {
+		return forms
+	}
+	slog.Warn("i18n: missing key", slog.String("key", key))
+	return nil
+}
+
+// pluralIndex — правила CLDR: ru one/few/many, en one/other
+func pluralIndex(lang string, n int) int {
+	if n < 0 {
+		n = -n
+	}
+	switch lang {
+	case langRU:
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return 0
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return 1
+		default:
+			return 2
+		}
+	default:
+		if n == 1 {
+			return 0
+		}
+		return 1
+	}
+}
+
+// ------------------------ User locale ------------------------
+
+// normalizeLang приводит language_code Telegram к поддерживаемому языку
+func normalizeLang(code string) string {
+	code = strings.ToLower(code)
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	switch code {
+	case "":
+		return defaultLang
+	case "ru", "uk", "be", "kk":
+		return langRU
+	default:
+		return langEN
+	}
+}
+
+// userLang выбирает язык пользователя: явный выбор через /language,
+// иначе language_code из Telegram. Код запоминается, чтобы уведомления,
+// отправленные этому пользователю позже, тоже были на его языке.
+func userLang(ctx context.Context, from *tgbot.User) string {
+	if from == nil {
+		return defaultLang
+	}
+	u, err := getUser(ctx, from.ID)
+	if err != nil {
+		logger(ctx).Error("load user", slog.Any("err", err))
+		return normalizeLang(from.LanguageCode)
+	}
+	if u.LanguageCode != from.LanguageCode {
+		u.LanguageCode = from.LanguageCode
+		if err := storage.SaveUser(ctx, u); err != nil {
+			logger(ctx).Error("save user", slog.Any("err", err))
+		}
+	}
+	return u.Lang()
+}
+
+// langOf возвращает язык пользователя, которому пишем не в ответ на его update
+func langOf(ctx context.Context, userID int64) string {
+	u, err := storage.GetUser(ctx, userID)
+	if err != nil || u == nil {
+		return defaultLang
+	}
+	return u.Lang()
+}
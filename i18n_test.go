@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestPluralIndex(t *testing.T) {
+	// индексы форм: ru 0 — one, 1 — few, 2 — many; en 0 — one, 1 — other
+	tests := []struct {
+		lang string
+		n    int
+		want int
+	}{
+		{langRU, 0, 2},
+		{langRU, 1, 0},
+		{langRU, 2, 1},
+		{langRU, 4, 1},
+		{langRU, 5, 2},
+		{langRU, 11, 2},
+		{langRU, 12, 2},
+		{langRU, 14, 2},
+		{langRU, 21, 0},
+		{langRU, 22, 1},
+		{langRU, 25, 2},
+		{langRU, 101, 0},
+		{langRU, 111, 2},
+		{langRU, -21, 0},
+		{langEN, 0, 1},
+		{langEN, 1, 0},
+		{langEN, 2, 1},
+		{langEN, 21, 1},
+	}
+	for _, tt := range tests {
+		if got := pluralIndex(tt.lang, tt.n); got != tt.want {
+			t.Errorf("pluralIndex(%s, %d) = %d, want %d", tt.lang, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ------------------------ JSON file persistence ------------------------
+// Данные JSONStorage лежат в двух файлах: снимок storage.json и журнал
+// storage.json.log. Каждое изменение дописывается в журнал одной строкой —
+// пачкой операций, которые применяются вместе, — так что запись не
+// пересериализует всё хранилище. Журнал fsync-ается через jsonSyncDelay после
+// первой записи. Когда в нём набирается jsonCompactOps строк, данные
+// сжимаются в новый снимок, а журнал очищается.
+//
+// Снимок не переписывается на месте: он пишется во временный файл рядом,
+// fsync, и rename подменяет файл целиком. Перед подменой текущая версия
+// сохраняется в storage.json.1 (старые сдвигаются до .N). Операции журнала
+// задают новое значение строки целиком, поэтому повторное применение журнала
+// поверх снимка, уже включающего его (падение между записью снимка и очисткой
+// журнала), ничего не меняет.
+
+const (
+	jsonSyncDelay  = 500 * time.Millisecond
+	jsonCompactOps = 1000
+)
+
+// jsonFile — снимок, журнал и резервные копии JSONStorage. Методы, меняющие
+// журнал или снимок (append, writeSnapshot), вызываются под мьютексом владельца.
+type jsonFile struct {
+	path    string
+	backups int
+
+	log     *os.File
+	logOps  int   // строк в журнале после последнего снимка
+	logSize int64 // длина журнала после последней целой строки
+
+	dirty    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	errMu   sync.Mutex
+	lastErr error // ошибка последней записи на диск; её видит Ping
+}
+
+func newJSONFile(path string, backups int) *jsonFile {
+	return &jsonFile{
+		path:    path,
+		backups: backups,
+		dirty:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (f *jsonFile) logPath() string { return f.path + ".log" }
+
+// backupPath — путь n-й резервной копии снимка (1 — самая свежая)
+func (f *jsonFile) backupPath(n int) string {
+	return f.path + "." + strconv.Itoa(n)
+}
+
+// load читает снимок в v и применяет журнал через replay, после чего открывает
+// журнал на дозапись. Отсутствующие файлы — пустое хранилище. Недописанная
+// последняя строка журнала (падение во время записи) отбрасывается. Повреждённый
+// снимок или строка журнала без recoverCorrupt — ошибка; с recoverCorrupt снимок
+// переименовывается в .corrupt-<время> и берётся из самой свежей читаемой
+// резервной копии, а журнал применяется до первой повреждённой строки.
+// Журнал продолжает повреждённый снимок, а не копию: поверх копии он дал бы
+// смесь старых и новых строк, поэтому в этом случае он не применяется, а
+// переносится в .corrupt-<время>.log рядом со снимком.
+// Возвращает true, если журнал не пуст и его стоит сжать в снимок.
+func (f *jsonFile) load(v any, recoverCorrupt bool, replay func(line []byte) error) (bool, error) {
+	corrupt, err := f.loadSnapshot(v, recoverCorrupt)
+	if err != nil {
+		return false, err
+	}
+	if corrupt != "" {
+		if err := os.Rename(f.logPath(), corrupt+".log"); err == nil {
+			slog.Warn("json storage log belongs to the unreadable snapshot, moved aside", slog.String("path", corrupt+".log"))
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	pending, err := f.replayLog(recoverCorrupt, replay)
+	if err != nil {
+		return false, err
+	}
+	f.log, err = os.OpenFile(f.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return false, err
+	}
+	st, err := f.log.Stat()
+	if err != nil {
+		f.log.Close()
+		return false, err
+	}
+	f.logSize = st.Size()
+	return pending, nil
+}
+
+// loadSnapshot читает снимок; если он повреждён и восстановлен из копии (или
+// начат с пустого), возвращает путь, куда перенесён повреждённый снимок
+func (f *jsonFile) loadSnapshot(v any, recoverCorrupt bool) (string, error) {
+	err := readJSONFile(f.path, v)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if !recoverCorrupt {
+		return "", fmt.Errorf("%s is unreadable (%w); restart with JSON_STORAGE_RECOVER=true to restore it from the newest valid backup", f.path, err)
+	}
+	corrupt := fmt.Sprintf("%s.corrupt-%d", f.path, time.Now().Unix())
+	if err := os.Rename(f.path, corrupt); err != nil {
+		return "", err
+	}
+	slog.Warn("json storage unreadable, moved aside", slog.String("path", corrupt), slog.Any("err", err))
+	for n := 1; n <= f.backups; n++ {
+		err := readJSONFile(f.backupPath(n), v)
+		if err == nil {
+			slog.Warn("json storage restored from backup", slog.String("backup", f.backupPath(n)))
+			return corrupt, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("json storage backup unreadable", slog.String("backup", f.backupPath(n)), slog.Any("err", err))
+		}
+	}
+	slog.Warn("no valid json storage backup, starting empty")
+	return corrupt, nil
+}
+
+func readJSONFile(path string, v any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// replayLog применяет строки журнала по порядку; возвращает true, если журнал не пуст
+func (f *jsonFile) replayLog(recoverCorrupt bool, replay func(line []byte) error) (bool, error) {
+	lf, err := os.Open(f.logPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer lf.Close()
+	r := bufio.NewReader(lf)
+	pending := false
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			pending = true
+		}
+		if err == io.EOF {
+			if len(line) > 0 {
+				slog.Warn("json storage log: dropping incomplete last entry", slog.Int("line", n))
+			}
+			return pending, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if err := replay(line); err != nil {
+			if !recoverCorrupt {
+				return false, fmt.Errorf("%s line %d is unreadable (%w); restart with JSON_STORAGE_RECOVER=true to drop it and everything after it", f.logPath(), n, err)
+			}
+			slog.Warn("json storage log: dropping corrupt entry and the rest of the log", slog.Int("line", n), slog.Any("err", err))
+			return pending, nil
+		}
+	}
+}
+
+// append дописывает строку в журнал и планирует fsync. Если запись оборвалась
+// на середине, журнал обрезается до последней целой строки: иначе следующая
+// запись склеилась бы с обрывком, и журнал перестал бы читаться.
+func (f *jsonFile) append(line []byte) error {
+	n, err := f.log.Write(append(line, '\n'))
+	if err != nil {
+		if tErr := os.Truncate(f.logPath(), f.logSize); tErr != nil {
+			err = errors.Join(err, fmt.Errorf("truncate torn entry: %w", tErr))
+		}
+		f.setErr(err)
+		return err
+	}
+	f.logSize += int64(n)
+	f.logOps++
+	select {
+	case f.dirty <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// needsCompaction вызывается под мьютексом владельца
+func (f *jsonFile) needsCompaction() bool {
+	return f.logOps >= jsonCompactOps
+}
+
+func (f *jsonFile) err() error {
+	f.errMu.Lock()
+	defer f.errMu.Unlock()
+	return f.lastErr
+}
+
+func (f *jsonFile) setErr(err error) {
+	if err != nil {
+		slog.Error("json storage write", slog.String("path", f.path), slog.Any("err", err))
+	}
+	f.errMu.Lock()
+	f.lastErr = err
+	f.errMu.Unlock()
+}
+
+// run fsync-ает журнал через jsonSyncDelay после первой записи и вызывает
+// maybeCompact, до close
+func (f *jsonFile) run(maybeCompact func()) {
+	defer close(f.done)
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-f.dirty:
+		}
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(jsonSyncDelay):
+		}
+		err := f.log.Sync()
+		f.setErr(err)
+		if err == nil {
+			maybeCompact()
+		}
+	}
+}
+
+// close останавливает фоновый цикл, сжимает журнал в снимок и закрывает журнал
+func (f *jsonFile) close(compact func() error) error {
+	f.stopOnce.Do(func() { close(f.stop) })
+	<-f.done
+	if err := compact(); err != nil {
+		return err
+	}
+	return f.log.Close()
+}
+
+// writeSnapshot заменяет снимок и очищает журнал; вызывается под мьютексом
+// владельца, чтобы в журнал не попало ничего, чего нет в снимке
+func (f *jsonFile) writeSnapshot(b []byte) error {
+	if err := f.writeAtomic(b); err != nil {
+		f.setErr(err)
+		return err
+	}
+	if err := f.log.Truncate(0); err != nil {
+		f.setErr(err)
+		return err
+	}
+	f.logOps = 0
+	f.logSize = 0
+	f.setErr(nil)
+	return nil
+}
+
+// writeAtomic атомарно заменяет снимок: временный файл, fsync, резервная копия, rename, fsync каталога
+func (f *jsonFile) writeAtomic(b []byte) error {
+	dir := filepath.Dir(f.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // после rename файла с этим именем уже нет
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	f.rotateBackups()
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// rotateBackups сдвигает копии .1….N-1 на одну позицию и делает текущий снимок
+// копией .1. Жёсткая ссылка оставляет сам файл на месте, так что до rename
+// нового снимка storage.json не пропадает ни на миг. Ошибки копий не мешают записи.
+func (f *jsonFile) rotateBackups() {
+	if f.backups <= 0 {
+		return
+	}
+	if _, err := os.Stat(f.path); err != nil {
+		return
+	}
+	for n := f.backups - 1; n >= 1; n-- {
+		if err := os.Rename(f.backupPath(n), f.backupPath(n+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("json storage backup rotate", slog.Any("err", err))
+		}
+	}
+	os.Remove(f.backupPath(1))
+	if err := os.Link(f.path, f.backupPath(1)); err != nil {
+		slog.Warn("json storage backup", slog.Any("err", err))
+	}
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestJSONFileRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "storage.json")
+	f := newJSONFile(path, 2)
+	log, err := os.Create(f.logPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.log = log
+	defer log.Close()
+	for i := 1; i <= 4; i++ {
+		if err := f.writeSnapshot([]byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// снимок — последняя версия, копии — две предыдущие, более старые удалены
+	for p, want := range map[string]string{path: "4", f.backupPath(1): "3", f.backupPath(2): "2"} {
+		b, err := os.ReadFile(p)
+		if err != nil || string(b) != want {
+			t.Fatalf("%s = %q, %v; want %q", p, b, err, want)
+		}
+	}
+	if _, err := os.Stat(f.backupPath(3)); !os.IsNotExist(err) {
+		t.Fatalf("backup 3 exists beyond the limit: %v", err)
+	}
+	// временные файлы после rename не остаются
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("files in dir: %v, %v; want snapshot, log and 2 backups", entries, err)
+	}
+}
+
+// usersLog — строки журнала, каждая сохраняет одного пользователя
+func usersLog(ids ...int64) string {
+	var out string
+	for _, id := range ids {
+		b, _ := json.Marshal([]jsonOp{jsonPut("users", id, User{UserID: id})})
+		out += string(b) + "\n"
+	}
+	return out
+}
+
+// seedJSON создаёт хранилище, сохраняет пользователей и закрывает его (снимок, пустой журнал)
+func seedJSON(t *testing.T, path string, ids ...int64) {
+	t.Helper()
+	if err := InitJSONStorage(path, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if err := storage.SaveUser(context.Background(), User{UserID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func jsonUserIDs() []int64 {
+	var ids []int64
+	for id := range storage.(*JSONStorage).Data.Users {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestJSONStorageLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		recover bool
+		wantErr bool
+		want    []int64
+	}{
+		{"журнал применяется после перезапуска", func(t *testing.T, path string) {
+			seedJSON(t, path, 1)
+			appendFile(t, path+".log", usersLog(2, 3))
+		}, false, false, []int64{1, 2, 3}},
+		{"недописанная последняя строка отбрасывается", func(t *testing.T, path string) {
+			seedJSON(t, path, 1)
+			appendFile(t, path+".log", usersLog(2)+`[{"t":"users","k":3`)
+		}, false, false, []int64{1, 2}},
+		{"повреждённая строка журнала без recover", func(t *testing.T, path string) {
+			seedJSON(t, path, 1)
+			appendFile(t, path+".log", usersLog(2)+"garbage\n"+usersLog(3))
+		}, false, true, nil},
+		{"повреждённая строка журнала с recover", func(t *testing.T, path string) {
+			seedJSON(t, path, 1)
+			appendFile(t, path+".log", usersLog(2)+"garbage\n"+usersLog(3))
+		}, true, false, []int64{1, 2}},
+		{"повреждённый снимок без recover", func(t *testing.T, path string) {
+			seedJSON(t, path, 1)
+			os.WriteFile(path, []byte("{"), 0644)
+		}, false, true, nil},
+		{"повреждённый снимок с recover: копия без чужого журнала", func(t *testing.T, path string) {
+			seedJSON(t, path, 1)
+			seedJSON(t, path, 2) // .1 — снимок с пользователем 1
+			os.WriteFile(path, []byte("{"), 0644)
+			appendFile(t, path+".log", usersLog(3))
+		}, true, false, []int64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.json")
+			tt.prepare(t, path)
+			err := InitJSONStorage(path, 2, tt.recover)
+			if tt.wantErr {
+				if err == nil {
+					storage.Close()
+					t.Fatal("loaded without error, want refusal")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := jsonUserIDs(); !slices.Equal(got, tt.want) {
+				t.Fatalf("users = %v, want %v", got, tt.want)
+			}
+			// журнал после загрузки сжат в снимок
+			if st, err := os.Stat(path + ".log"); err != nil || st.Size() != 0 {
+				t.Fatalf("log after load: %v, %v; want empty", st, err)
+			}
+			if err := storage.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// повторный запуск без recover видит те же данные
+			if err := InitJSONStorage(path, 2, false); err != nil {
+				t.Fatal(err)
+			}
+			defer storage.Close()
+			if got := jsonUserIDs(); !slices.Equal(got, tt.want) {
+				t.Fatalf("users after restart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONStorageRecoverMovesLogAside(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	seedJSON(t, path, 1)
+	seedJSON(t, path, 2)
+	os.WriteFile(path, []byte("{"), 0644)
+	appendFile(t, path+".log", usersLog(3))
+	if err := InitJSONStorage(path, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	logs, _ := filepath.Glob(path + ".corrupt-*.log")
+	if len(logs) != 1 {
+		t.Fatalf("moved-aside logs: %v, want one", logs)
+	}
+	if b, _ := os.ReadFile(logs[0]); string(b) != usersLog(3) {
+		t.Fatalf("moved-aside log = %q", b)
+	}
+}
+
+func TestJSONStorageCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	if err := InitJSONStorage(path, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	js := storage.(*JSONStorage)
+	for id := int64(1); id <= jsonCompactOps; id++ {
+		if err := js.SaveUser(context.Background(), User{UserID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	js.compactIfNeeded()
+	if st, err := os.Stat(path + ".log"); err != nil || st.Size() != 0 {
+		t.Fatalf("log after compaction: %v, %v; want empty", st, err)
+	}
+	var snap struct {
+		Users map[int64]User `json:"users"`
+	}
+	if err := readJSONFile(path, &snap); err != nil || len(snap.Users) != jsonCompactOps {
+		t.Fatalf("snapshot has %d users, %v; want %d", len(snap.Users), err, jsonCompactOps)
+	}
+	if err := js.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJSONFileAppendTruncatesTornEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	if err := InitJSONStorage(path, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	js := storage.(*JSONStorage)
+	ctx := context.Background()
+	if err := js.SaveUser(ctx, User{UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// запись оборвалась: на диске остался обрывок, а Write вернул ошибку
+	appendFile(t, path+".log", `[{"t":"users","k":2`)
+	good := js.file.log
+	ro, err := os.Open(path + ".log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	js.file.log = ro
+	if err := js.SaveUser(ctx, User{UserID: 2}); err == nil {
+		t.Fatal("SaveUser succeeded on a read-only log")
+	}
+	ro.Close()
+	js.file.log = good
+	if err := js.SaveUser(ctx, User{UserID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path + ".log"); string(b) != usersLog(1, 3) {
+		t.Fatalf("log = %q, want entries 1 and 3 only", b)
+	}
+	if err := js.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
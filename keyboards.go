@@ -2,63 +2,123 @@ package main
 
 import tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
-// Стартовые кнопки: Исполнитель и Клиент (рядом)
-func startKeyboard() tgbot.InlineKeyboardMarkup {
-	return tgbot.NewInlineKeyboardMarkup(
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("👷 Исполнитель", "role:executor"),
-			tgbot.NewInlineKeyboardButtonData("🧑‍💼 Клиент", "role:client"),
-		),
+// Все пункты меню бота регистрируются здесь, раскладки — ниже
+func init() {
+	menus.register(
+		menuItem{ID: "role:executor", Label: "btn.executor", Handler: onRoleExecutor},
+		menuItem{ID: "role:client", Label: "btn.client", Handler: onRoleClient},
+
+		menuItem{ID: "cat:design", Label: "btn.cat.design", Handler: onCategoryChosen("design")},
+		menuItem{ID: "cat:programming", Label: "btn.cat.programming", Handler: onCategoryChosen("programming")},
+		menuItem{ID: "cat:content", Label: "btn.cat.content", Handler: onCategoryChosen("content")},
+
+		menuItem{ID: "profile:edit", Label: "btn.profile.edit", Handler: onProfileEdit},
+		menuItem{ID: "profile:delete", Label: "btn.profile.delete", Handler: onProfileDelete},
+
+		menuItem{ID: "group:design", Label: "btn.cat.design", Handler: onBrowseCategory("design")},
+		menuItem{ID: "group:programming", Label: "btn.cat.programming", Handler: onBrowseCategory("programming")},
+		menuItem{ID: "group:content", Label: "btn.cat.content", Handler: onBrowseCategory("content")},
+
+		menuItem{ID: "order:edit", Label: "btn.order.edit", Handler: onOrderEdit},
+		menuItem{ID: "order:delete", Label: "btn.order.delete", Handler: onOrderDelete},
+
+		menuItem{ID: "search:executors", Label: "btn.search", Handler: onSearchExecutors},
+
+		menuItem{ID: "back:to_start", Label: "btn.back", Handler: onBackToStart},
+
+		menuItem{ID: "lang:ru", Label: "btn.lang.ru", Handler: onLanguageChosen(langRU)},
+		menuItem{ID: "lang:en", Label: "btn.lang.en", Handler: onLanguageChosen(langEN)},
 	)
+	menus.registerReply(profileMenu())
+	for _, c := range categories {
+		menus.registerReply(orderMenu(c))
+	}
+}
+
+// Стартовое меню: Исполнитель и Клиент (рядом)
+func startMenu() menu {
+	return menu{ID: "start", Kind: menuInline, Rows: [][]string{
+		{"role:executor", "role:client"},
+	}}
+}
+
+// Категории при выборе клиента (каждая на отдельном ряду)
+func categoriesMenu() menu {
+	return menu{ID: "categories", Kind: menuInline, Rows: [][]string{
+		{"cat:design"},
+		{"cat:programming"},
+		{"cat:content"},
+		{"search:executors"},
+		{"back:to_start"},
+	}}
+}
+
+// Меню профиля исполнителя: редактирование, удаление и просмотр анкет по категориям
+func profileMenu() menu {
+	return menu{ID: "profile", Kind: menuReply, Rows: [][]string{
+		{"profile:edit"},
+		{"profile:delete"},
+		{"group:design"},
+		{"group:programming"},
+		{"group:content"},
+		{"back:to_start"},
+	}}
+}
+
+// Меню анкеты клиента: редактирование, удаление, своя категория и поиск исполнителей
+func orderMenu(category string) menu {
+	return menu{ID: "order", Kind: menuReply, Rows: [][]string{
+		{"order:edit"},
+		{"order:delete"},
+		{"group:" + category},
+		{"search:executors"},
+		{"back:to_start"},
+	}}
+}
+
+// Выбор языка интерфейса
+func languageMenu() menu {
+	return menu{ID: "language", Kind: menuInline, Rows: [][]string{
+		{"lang:ru", "lang:en"},
+	}}
 }
 
-// Кнопки для категорий при выборе клиента (каждая на отдельном ряду)
-func categoriesKeyboard() tgbot.InlineKeyboardMarkup {
+// Кнопки под анкетой: Коннект и Жалоба
+func orderActionsKeyboard(lang string, orderID int64) tgbot.InlineKeyboardMarkup {
 	return tgbot.NewInlineKeyboardMarkup(
 		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("🎨 Дизайн", "cat:design"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("💻 Программирование", "cat:programming"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("📸 Контент-мейкинг", "cat:content"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("🔙 Назад", "back:to_start"),
+			tgbot.NewInlineKeyboardButtonData(T(lang, "btn.connect"), callbacks.encode("order.connect", orderID)),
+			tgbot.NewInlineKeyboardButtonData(T(lang, "btn.complain"), callbacks.encode("order.complain", orderID)),
 		),
 	)
 }
 
-// Кнопки для профиля (редактировать/удалить)
-func profileKeyboard() tgbot.InlineKeyboardMarkup {
+// Кнопка связи через бота с пользователем, скрывшим контакт
+func relayKeyboard(lang string, userID int64) tgbot.InlineKeyboardMarkup {
 	return tgbot.NewInlineKeyboardMarkup(
 		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("✏️ Редактировать профиль", "profile:edit"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("🗑️ Удалить профиль", "profile:delete"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("🔙 Назад", "back:to_start"),
+			tgbot.NewInlineKeyboardButtonData(T(lang, "btn.relay"), callbacks.encode("relay.start", userID)),
 		),
 	)
 }
 
-// Кнопки для групп работы после создания профиля (для исполнителя)
-func groupsKeyboard() tgbot.InlineKeyboardMarkup {
+// Подтверждение жалобы
+func complainConfirmKeyboard(lang string, orderID int64) tgbot.InlineKeyboardMarkup {
 	return tgbot.NewInlineKeyboardMarkup(
 		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("🎨 Дизайн", "group:design"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("💻 Программирование", "group:programming"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("📸 Контент-мейкинг", "group:content"),
-		),
-		tgbot.NewInlineKeyboardRow(
-			tgbot.NewInlineKeyboardButtonData("🔙 Назад", "back:to_profile"),
+			tgbot.NewInlineKeyboardButtonData(T(lang, "btn.complain.yes"), callbacks.encode("complain.confirm", orderID)),
+			tgbot.NewInlineKeyboardButtonData(T(lang, "btn.cancel"), callbacks.encode("complain.cancel")),
 		),
 	)
 }
+
+func categoryEmoji(cat string) string {
+	switch cat {
+	case "design":
+		return "🎨"
+	case "programming":
+		return "💻"
+	default:
+		return "📸"
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Logging ------------------------
+// Логи пишутся через slog: LOG_LEVEL (debug, info, warn, error) и LOG_FORMAT
+// (text, json). Пока обрабатывается апдейт, логгер берётся из ctx и несёт
+// update_id, user_id, chat_id и маршрут обработчика; по завершении пишется
+// строка с задержкой. Тексты сообщений пользователей в лог не попадают,
+// если не задан LOG_MESSAGE_TEXT=true.
+
+var logMessageText bool
+
+// initLogging настраивает логгер по умолчанию; стандартный log тоже идёт через него
+func initLogging(cfg Config) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if strings.EqualFold(cfg.LogFormat, "json") {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(h))
+	logMessageText = cfg.LogMessageText
+}
+
+// fatal пишет ошибку и завершает процесс, как log.Fatalf
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// updateLog — контекст логирования одного апдейта
+type updateLog struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+	route  string
+}
+
+type updateLogKey struct{}
+
+// withUpdateLog кладёт в ctx логгер с атрибутами апдейта
+func withUpdateLog(ctx context.Context, upd *tgbot.Update) (context.Context, *updateLog) {
+	attrs := []any{slog.Int("update_id", upd.UpdateID), slog.String("type", updateType(upd))}
+	if from := upd.SentFrom(); from != nil {
+		attrs = append(attrs, slog.Int64("user_id", from.ID))
+	}
+	if chat := updateChat(upd); chat != nil {
+		attrs = append(attrs, slog.Int64("chat_id", chat.ID))
+	}
+	ul := &updateLog{logger: slog.Default().With(attrs...)}
+	return context.WithValue(ctx, updateLogKey{}, ul), ul
+}
+
+// updateChat — чат апдейта; в отличие от FromChat не паникует на колбэке без сообщения
+func updateChat(upd *tgbot.Update) *tgbot.Chat {
+	if upd.CallbackQuery != nil {
+		if upd.CallbackQuery.Message != nil {
+			return upd.CallbackQuery.Message.Chat
+		}
+		return nil
+	}
+	return upd.FromChat()
+}
+
+// setRoute запоминает, какой обработчик выбран для апдейта
+func setRoute(ctx context.Context, route string) {
+	if ul, ok := ctx.Value(updateLogKey{}).(*updateLog); ok {
+		ul.mu.Lock()
+		ul.route = route
+		ul.mu.Unlock()
+	}
+}
+
+// logger возвращает логгер апдейта из ctx или логгер по умолчанию
+func logger(ctx context.Context) *slog.Logger {
+	ul, ok := ctx.Value(updateLogKey{}).(*updateLog)
+	if !ok {
+		return slog.Default()
+	}
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+	if ul.route == "" {
+		return ul.logger
+	}
+	return ul.logger.With(slog.String("route", ul.route))
+}
+
+// done пишет итоговую строку по апдейту
+func (ul *updateLog) done(ctx context.Context, start time.Time) {
+	logger(ctx).Info("update handled", slog.Duration("latency", time.Since(start)))
+}
+
+// redact скрывает текст пользователя, оставляя только длину
+func redact(text string) slog.Attr {
+	if logMessageText {
+		return slog.String("text", text)
+	}
+	return slog.String("text", fmt.Sprintf("[redacted %d chars]", utf8.RuneCountInString(text)))
+}
@@ -2,49 +2,140 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 )
 
+// Бюджеты фаз остановки: HTTP-сервер, разбор очередей, выход диспетчера outbox
+const (
+	httpShutdownTimeout = 5 * time.Second
+	drainTimeout        = 10 * time.Second
+	outboxStopTimeout   = 5 * time.Second
+)
+
+const usage = `usage: conectwork [command]
+
+commands:
+  serve            run the bot (default)
+  webhook set      register TELEGRAM_WEBHOOK_URL/webhook/<WEBHOOK_SECRET> with Telegram
+  webhook info     show webhook status: URL, pending updates, last delivery error
+  webhook delete   remove the webhook
+  migrate up       apply pending database migrations (-to N to stop at version N)
+  migrate down     roll back the last migration (-steps N for more)
+  migrate status   list migrations and whether they are applied
+`
+
 func main() {
 	cfg := LoadConfigFromEnv()
+	initLogging(cfg)
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "serve":
+		serve(cfg)
+	case "webhook":
+		os.Exit(runWebhookCmd(cfg, args))
+	case "migrate":
+		os.Exit(runMigrateCmd(cfg, args))
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+// serve запускает бота: хранилище, воркеры, приём апдейтов и HTTP-сервер
+func serve(cfg Config) {
 	bot := InitBot(cfg.TelegramToken)
 	defer bot.Shutdown()
+	callbacks.setKey(callbackKey(cfg))
+	categoryGroups = cfg.CategoryGroups()
+	adminIDs = cfg.AdminIDs
 
-	// Init storage (Postgres preferred; fallback to JSON file)
-	if cfg.DatabaseURL != "" {
+	// Init storage (Postgres preferred; SQLite for sqlite:// URLs; fallback to JSON file)
+	if path, ok := sqlitePath(cfg.DatabaseURL); ok {
+		if err := InitSQLite(path); err != nil {
+			fatal("failed to init sqlite", slog.Any("err", err))
+		}
+		slog.Info("using SQLite storage", slog.String("path", path))
+	} else if cfg.DatabaseURL != "" {
 		if err := InitPostgres(cfg.DatabaseURL); err != nil {
-			log.Fatalf("failed to init postgres: %v", err)
+			fatal("failed to init postgres", slog.Any("err", err))
 		}
-		log.Println("Using Postgres storage")
+		slog.Info("using Postgres storage")
 	} else {
-		if err := InitJSONStorage("storage.json"); err != nil {
-			log.Fatalf("failed to init json storage: %v", err)
+		if err := InitJSONStorage("storage.json", cfg.JSONBackups, cfg.JSONRecover); err != nil {
+			fatal("failed to init json storage", slog.Any("err", err))
 		}
-		log.Println("Using JSON file storage (fallback). For production use Postgres.")
+		slog.Warn("using JSON file storage (fallback); for production use Postgres")
 	}
 
-	// Set webhook asynchronously to не блокировать main
-	if cfg.WebhookURL != "" && cfg.WebhookSecret != "" {
-		go func() {
-			whURL := cfg.WebhookURL + "/webhook/" + cfg.WebhookSecret
-			if err := bot.SetWebhook(whURL); err != nil {
-				log.Printf("setWebhook warning: %v", err)
-			} else {
-				log.Printf("webhook set to %s", whURL)
-			}
-		}()
+	storage = instrumentStorage(storage)
+
+	// ctx останавливает приём апдейтов и фоновые циклы сразу по сигналу;
+	// workCtx — обработку уже принятых апдейтов и отправку, он отменяется,
+	// когда истекает время на graceful shutdown
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	startWorkers(workCtx, bot, cfg)
+	startInFlightCleaner(ctx)
+	startStorageCleaner(ctx)
+	// outboxDone закрывается, когда диспетчер outbox вышел: до этого он может
+	// отмечать отправленные сообщения, и хранилище закрывать нельзя
+	outboxDone := make(chan struct{})
+	go func() {
+		defer close(outboxDone)
+		runOutboxDispatcher(ctx)
+	}()
+	slog.Info("workers started", slog.Int("update_workers", cfg.UpdateWorkers), slog.Int("send_workers", cfg.SendWorkers))
+
+	switch cfg.Mode {
+	case ModePolling:
+		// Long polling: вебхук снимается, публичный URL не нужен
+		if err := startPolling(ctx, bot); err != nil {
+			fatal("failed to start polling", slog.Any("err", err))
+		}
+		slog.Info("receiving updates via long polling")
+	case ModeWebhook:
+		secretToken := webhookSecretToken(cfg)
+		allowed, err := parseCIDRs(cfg.WebhookCIDRs)
+		if err != nil {
+			fatal("bad WEBHOOK_ALLOWED_CIDRS", slog.Any("err", err))
+		}
+		// Set webhook asynchronously to не блокировать main
+		if cfg.WebhookURL != "" && cfg.WebhookSecret != "" {
+			go func() {
+				whURL := webhookEndpoint(cfg)
+				if err := bot.SetWebhook(whURL, secretToken); err != nil {
+					slog.Warn("setWebhook failed", slog.Any("err", err))
+				} else {
+					slog.Info("webhook set", slog.String("url", cfg.WebhookURL+"/webhook/***"))
+				}
+			}()
+		}
+		// HTTP Handlers с panic recovery
+		http.HandleFunc("/webhook/"+cfg.WebhookSecret, recoveryMiddleware(
+			webhookAuth(secretToken, allowed, cfg.WebhookTrustProxy, makeWebhookHandler(bot))))
+	default:
+		fatal("unknown MODE", slog.String("mode", cfg.Mode), slog.String("want", ModeWebhook+" or "+ModePolling))
 	}
 
-	// HTTP Handlers с panic recovery
-	http.HandleFunc("/webhook/"+cfg.WebhookSecret, recoveryMiddleware(makeWebhookHandler(bot)))
-	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-		w.Write([]byte("ok"))
-	})
+	http.Handle("/metrics", metricsHandler())
+	// /healthz оставлен для совместимости и равен /livez
+	http.HandleFunc("/healthz", livezHandler)
+	http.HandleFunc("/livez", livezHandler)
+	http.HandleFunc("/readyz", makeReadyzHandler(bot))
 
 	// Server config
 	port := cfg.Port
@@ -60,24 +151,42 @@ func main() {
 
 	// Graceful shutdown
 	go func() {
-		log.Printf("listening on :%s", port)
+		slog.Info("listening", slog.String("addr", ":"+port))
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
+			fatal("server error", slog.Any("err", err))
 		}
 	}()
 
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
+	stop()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// у каждой фазы остановки свой бюджет: медленная фаза не съедает время следующей
+	httpCtx, cancelHTTP := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancelHTTP()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		slog.Warn("http server forced to shutdown", slog.Any("err", err))
+	}
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("server forced to shutdown: %v", err)
+	// Новые апдейты больше не поступают — дорабатываем то, что уже в очередях.
+	// Не успевшие за drainTimeout запросы к хранилищу и отправки прерываются.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelDrain()
+	context.AfterFunc(drainCtx, cancelWork)
+	if err := stopWorkers(drainCtx); err != nil {
+		slog.Warn("queues not drained before timeout", slog.Any("err", err))
+	}
+	select {
+	case <-outboxDone:
+	case <-time.After(outboxStopTimeout):
+		slog.Warn("outbox dispatcher did not stop before timeout")
+	}
+	if err := storage.Close(); err != nil {
+		slog.Error("close storage", slog.Any("err", err))
 	}
-	log.Println("Server exited gracefully")
+	slog.Info("server exited gracefully")
 }
 
 // recoveryMiddleware ловит паники в HTTP handler и логирует их
@@ -85,7 +194,7 @@ func recoveryMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				log.Printf("panic recovered: %v", rec)
+				slog.Error("panic recovered", slog.Any("panic", rec), slog.String("path", r.URL.Path))
 				w.WriteHeader(http.StatusInternalServerError)
 			}
 		}()
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Menu registry ------------------------
+// Каждая кнопка бота — это пункт меню с ID, ключом подписи в каталоге и обработчиком.
+// Меню — это раскладка ID пунктов по рядам; одно и то же меню может быть
+// отрисовано как inline-клавиатура (маршрут "menu" с ID пункта) или как
+// reply-клавиатура (нажатие приходит текстом подписи на языке пользователя). Нажатия в обоих
+// случаях диспетчеризуются через реестр, а не сравнением строк в хендлерах.
+// Подписи reply-меню однозначно определяют пункт на всех языках сразу, поэтому
+// нажатие распознаётся без памяти о показанных клавиатурах — и после рестарта,
+// и на другой реплике.
+
+type menuKind int
+
+const (
+	menuInline menuKind = iota
+	menuReply
+)
+
+// menuPress описывает нажатие на пункт меню
+type menuPress struct {
+	UserID int64
+	ChatID int64
+	From   *tgbot.User
+	Lang   string
+}
+
+type menuHandler func(ctx context.Context, b *Bot, p menuPress)
+
+type menuItem struct {
+	ID      string
+	Label   string // ключ каталога i18n
+	Handler menuHandler
+}
+
+type menu struct {
+	ID   string
+	Kind menuKind
+	Rows [][]string
+}
+
+type menuRegistry struct {
+	mu    sync.Mutex
+	items map[string]menuItem
+	// подпись пункта reply-меню на каждом из языков → ID пункта
+	replyLabels map[string]string
+}
+
+var menus = &menuRegistry{
+	items:       map[string]menuItem{},
+	replyLabels: map[string]string{},
+}
+
+// register добавляет пункты в реестр; повторный ID — ошибка программиста
+func (r *menuRegistry) register(items ...menuItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, it := range items {
+		if _, dup := r.items[it.ID]; dup {
+			panic("menu item registered twice: " + it.ID)
+		}
+		r.items[it.ID] = it
+	}
+}
+
+// registerReply запоминает подписи пунктов reply-меню. Одна подпись у разных
+// пунктов — ошибка программиста: нажатие нельзя было бы распознать.
+func (r *menuRegistry) registerReply(ms ...menu) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range ms {
+		for _, ids := range m.Rows {
+			for _, id := range ids {
+				it, ok := r.items[id]
+				if !ok {
+					panic("unknown menu item in reply menu " + m.ID + ": " + id)
+				}
+				for _, lang := range supportedLangs {
+					label := T(lang, it.Label)
+					if prev, dup := r.replyLabels[label]; dup && prev != id {
+						panic("reply menu label " + label + " used by " + prev + " and " + id)
+					}
+					r.replyLabels[label] = id
+				}
+			}
+		}
+	}
+}
+
+func (r *menuRegistry) item(id string) (menuItem, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	it, ok := r.items[id]
+	return it, ok
+}
+
+// inlineMarkup рисует меню inline-кнопками
+func (r *menuRegistry) inlineMarkup(m menu, lang string) tgbot.InlineKeyboardMarkup {
+	rows := make([][]tgbot.InlineKeyboardButton, 0, len(m.Rows))
+	for _, ids := range m.Rows {
+		row := make([]tgbot.InlineKeyboardButton, 0, len(ids))
+		for _, id := range ids {
+			it, ok := r.item(id)
+			if !ok {
+				continue
+			}
+			row = append(row, tgbot.NewInlineKeyboardButtonData(T(lang, it.Label), callbacks.encode("menu", it.ID)))
+		}
+		rows = append(rows, row)
+	}
+	return tgbot.NewInlineKeyboardMarkup(rows...)
+}
+
+// replyMarkup рисует меню кнопками reply-клавиатуры
+func (r *menuRegistry) replyMarkup(m menu, lang string) tgbot.ReplyKeyboardMarkup {
+	rows := make([][]tgbot.KeyboardButton, 0, len(m.Rows))
+	for _, ids := range m.Rows {
+		row := make([]tgbot.KeyboardButton, 0, len(ids))
+		for _, id := range ids {
+			it, ok := r.item(id)
+			if !ok {
+				continue
+			}
+			row = append(row, tgbot.NewKeyboardButton(T(lang, it.Label)))
+		}
+		rows = append(rows, row)
+	}
+	kb := tgbot.NewReplyKeyboard(rows...)
+	kb.ResizeKeyboard = true
+	return kb
+}
+
+// showMenu отправляет текст с клавиатурой меню
+func showMenu(b *Bot, chatID int64, lang, text string, m menu) {
+	msg := tgbot.NewMessage(chatID, text)
+	switch m.Kind {
+	case menuReply:
+		msg.ReplyMarkup = menus.replyMarkup(m, lang)
+	default:
+		msg.ReplyMarkup = menus.inlineMarkup(m, lang)
+	}
+	sendMessage(msg)
+}
+
+// dispatchCallback вызывает обработчик inline-пункта по его ID
+func (r *menuRegistry) dispatchCallback(ctx context.Context, b *Bot, p menuPress, id string) bool {
+	it, ok := r.item(id)
+	if !ok {
+		return false
+	}
+	r.run(ctx, b, p, it)
+	return true
+}
+
+// dispatchText ищет нажатую reply-кнопку по подписи на любом из языков:
+// клавиатура могла быть показана до смены языка
+func (r *menuRegistry) dispatchText(ctx context.Context, b *Bot, p menuPress, text string) bool {
+	r.mu.Lock()
+	id, ok := r.replyLabels[text]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	it, ok := r.item(id)
+	if !ok {
+		return false
+	}
+	r.run(ctx, b, p, it)
+	return true
+}
+
+// run сбрасывает незавершённый мастер пользователя и вызывает обработчик;
+// пункты, начинающие новый мастер, сами выставляют состояние заново
+func (r *menuRegistry) run(ctx context.Context, b *Bot, p menuPress, it menuItem) {
+	setRoute(ctx, "menu:"+it.ID)
+	clearUserState(p.UserID)
+	it.Handler(ctx, b, p)
+}
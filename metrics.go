@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ------------------------ Metrics ------------------------
+// Метрики Prometheus отдаются на /metrics. Метки имеют ограниченный набор
+// значений: тип апдейта, имя маршрута колбэка, код ошибки Telegram, метод Storage.
+
+var (
+	updatesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "conectwork_updates_total",
+		Help: "Updates received from Telegram (webhook or getUpdates), by type, including duplicates and rejected ones.",
+	}, []string{"type"})
+
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "conectwork_handler_duration_seconds",
+		Help:    "Time spent processing an update, by type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"type"})
+
+	callbacksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "conectwork_callbacks_total",
+		Help: "Callback queries by route; rejected callbacks are counted under route \"invalid\".",
+	}, []string{"route"})
+
+	sendAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "conectwork_send_attempts_total",
+		Help: "Outbound Telegram requests, by result code (ok, Telegram error code or network).",
+	}, []string{"code"})
+
+	sendFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "conectwork_send_failures_total",
+		Help: "Messages given up on and written to the dead-letter log, by last error code.",
+	}, []string{"code"})
+
+	updatePanicsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "conectwork_update_panics_total",
+		Help: "Panics recovered while processing an update, by update type.",
+	}, []string{"type"})
+
+	quarantinedUpdatesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "conectwork_quarantined_updates_total",
+		Help: "Updates dropped because their user or chat is quarantined after repeated panics.",
+	})
+
+	shedUpdatesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "conectwork_shed_updates_total",
+		Help: "Updates dropped because their user's shard queue was full.",
+	})
+
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "conectwork_storage_duration_seconds",
+		Help:    "Storage operation latency, by Storage method and result.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"method", "result"})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "conectwork_updates_queue_depth",
+		Help: "Updates waiting in updatesChan.",
+	}, func() float64 { return float64(len(updatesChan)) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "conectwork_messages_queue_depth",
+		Help: "Messages waiting in messagesChan.",
+	}, func() float64 { return float64(len(messagesChan)) })
+	prometheus.MustRegister(orderStatsCollector{})
+}
+
+// metricsHandler — обработчик /metrics
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// updateType — значение метки type для апдейта
+func updateType(upd *tgbot.Update) string {
+	switch {
+	case upd.Message != nil:
+		return "message"
+	case upd.EditedMessage != nil:
+		return "edited_message"
+	case upd.CallbackQuery != nil:
+		return "callback_query"
+	case upd.MyChatMember != nil:
+		return "my_chat_member"
+	case upd.ChatMember != nil:
+		return "chat_member"
+	default:
+		return "other"
+	}
+}
+
+// countUpdate учитывает апдейт на входе, до дедупликации и постановки в очередь
+func countUpdate(upd *tgbot.Update) {
+	updatesTotal.WithLabelValues(updateType(upd)).Inc()
+}
+
+// observeUpdate учитывает время обработки; вызывать через defer в начале обработки
+func observeUpdate(upd *tgbot.Update, start time.Time) {
+	handlerDuration.WithLabelValues(updateType(upd)).Observe(time.Since(start).Seconds())
+}
+
+// sendErrorCode — значение метки code для результата запроса к Telegram
+func sendErrorCode(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var apiErr *tgbot.Error
+	if errors.As(err, &apiErr) {
+		return strconv.Itoa(apiErr.Code)
+	}
+	return "network"
+}
+
+// orderStatsCollector считает анкеты и жалобы по категориям во время опроса
+type orderStatsCollector struct{}
+
+var (
+	ordersDesc = prometheus.NewDesc("conectwork_orders",
+		"Open orders, by category.", []string{"category"}, nil)
+	complaintsDesc = prometheus.NewDesc("conectwork_order_complaints",
+		"Complaints on open orders, by category.", []string{"category"}, nil)
+)
+
+func (orderStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ordersDesc
+	ch <- complaintsDesc
+}
+
+func (orderStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	if storage == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stats, err := storage.OrderStats(ctx)
+	if err != nil {
+		slog.Error("metrics: order stats", slog.Any("err", err))
+		return
+	}
+	for _, s := range stats {
+		ch <- prometheus.MustNewConstMetric(ordersDesc, prometheus.GaugeValue, float64(s.Orders), s.Category)
+		ch <- prometheus.MustNewConstMetric(complaintsDesc, prometheus.GaugeValue, float64(s.Complaints), s.Category)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ------------------------ Migrations ------------------------
+// Схема описана пронумерованными миграциями в migrations/<диалект>:
+// NNNN_name.up.sql и NNNN_name.down.sql. У Postgres и SQLite один и тот же
+// набор версий, отличается только SQL. Применённые версии записываются в
+// schema_version. Каждая миграция выполняется в своей транзакции. Несколько
+// реплик Postgres, стартующих одновременно, не мешают друг другу: раннер
+// держит advisory lock на время работы.
+
+//go:embed migrations
+var migrationsFS embed.FS
+
+// migrationLockKey — ключ pg_advisory_lock для раннера миграций
+const migrationLockKey = 0x636f6e6563 // "conec"
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations читает миграции диалекта, упорядоченные по версии
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationsFS, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var dirUp bool
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			dirUp = true
+		case strings.HasSuffix(name, ".down.sql"):
+		default:
+			continue
+		}
+		num, rest, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: want NNNN_name.up.sql", name)
+		}
+		v, err := strconv.Atoi(num)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("migration %s: bad version", name)
+		}
+		body, err := fs.ReadFile(migrationsFS, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[v]
+		if m == nil {
+			m = &migration{Version: v, Name: strings.TrimSuffix(strings.TrimSuffix(rest, ".up.sql"), ".down.sql")}
+			byVersion[v] = m
+		}
+		if dirUp {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	out := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s: missing up script", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].Version < out[k].Version })
+	return out, nil
+}
+
+// migrator — база, над которой работает раннер миграций
+type migrator interface {
+	dialect() string
+	// lock берёт блокировку раннера и создаёт schema_version
+	lock(ctx context.Context) (unlock func(), err error)
+	applied(ctx context.Context) (map[int]time.Time, error)
+	// apply выполняет скрипт миграции и добавляет (up) или удаляет её версию в одной транзакции
+	apply(ctx context.Context, m migration, up bool) error
+}
+
+// migrateUp применяет все неприменённые миграции до версии target (0 — до последней)
+func migrateUp(ctx context.Context, db migrator, target int) error {
+	migrations, err := loadMigrations(db.dialect())
+	if err != nil {
+		return err
+	}
+	unlock, err := db.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	applied, err := db.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := db.apply(ctx, m, true); err != nil {
+			return fmt.Errorf("%04d_%s up: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// migrateDown откатывает steps последних применённых миграций
+func migrateDown(ctx context.Context, db migrator, steps int) error {
+	migrations, err := loadMigrations(db.dialect())
+	if err != nil {
+		return err
+	}
+	unlock, err := db.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	applied, err := db.applied(ctx)
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("%04d_%s: no down script", m.Version, m.Name)
+		}
+		if err := db.apply(ctx, m, false); err != nil {
+			return fmt.Errorf("%04d_%s down: %w", m.Version, m.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+// migrationStatus — строка на каждую известную миграцию: применена ли и когда
+func migrationStatus(ctx context.Context, db migrator) ([]string, error) {
+	migrations, err := loadMigrations(db.dialect())
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := db.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	applied, err := db.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, m := range migrations {
+		state := "pending"
+		if at, ok := applied[m.Version]; ok {
+			state = "applied " + at.UTC().Format(time.RFC3339)
+		}
+		out = append(out, fmt.Sprintf("%04d_%s\t%s", m.Version, m.Name, state))
+	}
+	return out, nil
+}
+
+// pgMigrator держит отдельное соединение пула, на котором взят advisory lock
+type pgMigrator struct {
+	pool *pgxpool.Pool
+	conn *pgxpool.Conn
+}
+
+func (p *pgMigrator) dialect() string { return "postgres" }
+
+func (p *pgMigrator) lock(ctx context.Context) (func(), error) {
+	conn, err := p.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	unlock := func() {
+		conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+		conn.Release()
+	}
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+	version INT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+)`); err != nil {
+		unlock()
+		return nil, err
+	}
+	p.conn = conn
+	return unlock, nil
+}
+
+func (p *pgMigrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := p.conn.Query(ctx, `SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		out[v] = at
+	}
+	return out, rows.Err()
+}
+
+func (p *pgMigrator) apply(ctx context.Context, m migration, up bool) error {
+	return pgx.BeginFunc(ctx, p.conn, func(tx pgx.Tx) error {
+		if !up {
+			if _, err := tx.Exec(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, `DELETE FROM schema_version WHERE version=$1`, m.Version)
+			return err
+		}
+		if _, err := tx.Exec(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO schema_version (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+		return err
+	})
+}
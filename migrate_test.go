@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sqliteSchema — DDL всех таблиц и индексов, кроме schema_version
+func sqliteSchema(t *testing.T, m *sqliteMigrator) string {
+	t.Helper()
+	rows, err := m.db.Query(`SELECT sql FROM sqlite_master WHERE sql IS NOT NULL AND name <> 'schema_version' ORDER BY type, name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(out, ";\n")
+}
+
+func appliedVersions(t *testing.T, m *sqliteMigrator) []int {
+	t.Helper()
+	applied, err := m.applied(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := []int{}
+	for v := range applied {
+		out = append(out, v)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func versionsUpTo(migrations []migration, n int) []int {
+	out := []int{}
+	for _, m := range migrations[:n] {
+		out = append(out, m.Version)
+	}
+	return out
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no postgres migrations embedded")
+	}
+	// версии идут подряд с 1, у каждой есть up и down
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+		if m.Name == "" || m.Up == "" || m.Down == "" {
+			t.Errorf("%04d_%s: name, up or down script missing", m.Version, m.Name)
+		}
+	}
+	if _, err := loadMigrations("nosuchdialect"); err == nil {
+		t.Error("loadMigrations(nosuchdialect) = nil error")
+	}
+}
+
+func TestMigrationsSameVersionsAcrossDialects(t *testing.T) {
+	pg, err := loadMigrations("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sq, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pg) != len(sq) {
+		t.Fatalf("postgres has %d migrations, sqlite %d", len(pg), len(sq))
+	}
+	for i := range pg {
+		if pg[i].Version != sq[i].Version || pg[i].Name != sq[i].Name {
+			t.Errorf("migration %d: postgres %04d_%s, sqlite %04d_%s", i, pg[i].Version, pg[i].Name, sq[i].Version, sq[i].Name)
+		}
+		if pg[i].Down == "" || sq[i].Down == "" {
+			t.Errorf("%04d_%s: missing down script", pg[i].Version, pg[i].Name)
+		}
+	}
+}
+
+func TestSQLiteMigrateUpDownUp(t *testing.T) {
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// откат на каждую глубину, от последней миграции до пустой базы
+	for steps := 1; steps <= len(migrations); steps++ {
+		t.Run(migrations[len(migrations)-steps].Name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := openSQLite(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			m := &sqliteMigrator{db: db}
+
+			if err := migrateUp(ctx, m, 0); err != nil {
+				t.Fatalf("up: %v", err)
+			}
+			want := sqliteSchema(t, m)
+			if got := appliedVersions(t, m); !slices.Equal(got, versionsUpTo(migrations, len(migrations))) {
+				t.Fatalf("after up: applied %v", got)
+			}
+
+			if err := migrateDown(ctx, m, steps); err != nil {
+				t.Fatalf("down %d: %v", steps, err)
+			}
+			if got, wantV := appliedVersions(t, m), versionsUpTo(migrations, len(migrations)-steps); !slices.Equal(got, wantV) {
+				t.Fatalf("after down %d: applied %v, want %v", steps, got, wantV)
+			}
+
+			if err := migrateUp(ctx, m, 0); err != nil {
+				t.Fatalf("up again: %v", err)
+			}
+			if got := sqliteSchema(t, m); got != want {
+				t.Fatalf("schema after up/down/up differs:\n%s\nwant:\n%s", got, want)
+			}
+			status, err := migrationStatus(ctx, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range status {
+				if !strings.Contains(line, "\tapplied ") {
+					t.Errorf("status: %q", line)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLiteMigrateUpToTarget(t *testing.T) {
+	ctx := context.Background()
+	db, err := openSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m := &sqliteMigrator{db: db}
+	if err := migrateUp(ctx, m, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := appliedVersions(t, m); !slices.Equal(got, []int{1}) {
+		t.Fatalf("applied %v, want [1]", got)
+	}
+	// повторный up до той же версии ничего не делает
+	if err := migrateUp(ctx, m, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateUp(ctx, m, 0); err != nil {
+		t.Fatal(err)
+	}
+}
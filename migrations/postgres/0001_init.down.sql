@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS seen_updates;
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS group_chats;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS profiles;
@@ -0,0 +1,64 @@
+-- Исходная схема. IF NOT EXISTS: база, созданная до появления миграций
+-- (схема из InitPostgres), принимается как уже находящаяся на версии 1.
+
+CREATE TABLE IF NOT EXISTS profiles (
+	user_id BIGINT PRIMARY KEY,
+	username TEXT,
+	description TEXT,
+	photo_file_id TEXT,
+	updated_at TIMESTAMP DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS orders (
+	id BIGSERIAL PRIMARY KEY,
+	creator_id BIGINT,
+	category TEXT,
+	text TEXT,
+	photo_file_id TEXT,
+	group_message_id BIGINT,
+	complaints INT DEFAULT 0,
+	created_at TIMESTAMP DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS users (
+	user_id BIGINT PRIMARY KEY,
+	language TEXT NOT NULL DEFAULT '',
+	language_code TEXT NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT NOW()
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS notify_categories TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS contact_visibility TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hidden_from_search BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS unreachable BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGSERIAL PRIMARY KEY,
+	dedup_key TEXT NOT NULL UNIQUE,
+	chat_id BIGINT NOT NULL,
+	text TEXT NOT NULL DEFAULT '',
+	photo_file_id TEXT NOT NULL DEFAULT '',
+	parse_mode TEXT NOT NULL DEFAULT '',
+	reply_markup TEXT NOT NULL DEFAULT '',
+	attempts INT NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	locked_until TIMESTAMP,
+	created_at TIMESTAMP DEFAULT NOW(),
+	sent_at TIMESTAMP,
+	failed_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL AND failed_at IS NULL;
+CREATE TABLE IF NOT EXISTS group_chats (
+	chat_id BIGINT PRIMARY KEY,
+	title TEXT NOT NULL DEFAULT '',
+	bot_status TEXT NOT NULL DEFAULT '',
+	updated_at TIMESTAMP DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS group_members (
+	chat_id BIGINT NOT NULL,
+	user_id BIGINT NOT NULL,
+	status TEXT NOT NULL,
+	updated_at TIMESTAMP DEFAULT NOW(),
+	PRIMARY KEY (chat_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS seen_updates (
+	update_id BIGINT PRIMARY KEY,
+	seen_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS seen_updates_seen_at_idx ON seen_updates (seen_at);
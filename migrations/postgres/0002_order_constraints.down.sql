@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS orders_category_status_created_idx;
+DROP INDEX IF EXISTS orders_one_active_per_creator;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_text_length_check;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_category_check;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS profiles_user_fk;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_creator_fk;
+ALTER TABLE orders ALTER COLUMN creator_id DROP NOT NULL;
+-- до 0002 закрытые анкеты удалялись
+DELETE FROM orders WHERE status <> 'active';
+ALTER TABLE orders DROP COLUMN closed_at;
+ALTER TABLE orders DROP COLUMN status;
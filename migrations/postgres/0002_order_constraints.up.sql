@@ -0,0 +1,28 @@
+-- Статус анкеты вместо удаления строк: на нём держится правило
+-- «одна активная анкета на создателя» и индекс для выборки по категории.
+ALTER TABLE orders ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE orders ADD COLUMN closed_at TIMESTAMP;
+
+-- Из-за гонки check-then-insert у создателя могло оказаться несколько анкет:
+-- активной остаётся самая новая.
+UPDATE orders o SET status = 'closed', closed_at = NOW()
+WHERE EXISTS (SELECT 1 FROM orders n WHERE n.creator_id = o.creator_id AND n.id > o.id);
+
+DELETE FROM orders WHERE creator_id IS NULL;
+ALTER TABLE orders ALTER COLUMN creator_id SET NOT NULL;
+
+-- Внешние ключи на users: строки пользователей создаются по требованию,
+-- поэтому сначала добавляем недостающие.
+INSERT INTO users (user_id) SELECT DISTINCT creator_id FROM orders ON CONFLICT DO NOTHING;
+INSERT INTO users (user_id) SELECT user_id FROM profiles ON CONFLICT DO NOTHING;
+ALTER TABLE orders ADD CONSTRAINT orders_creator_fk FOREIGN KEY (creator_id) REFERENCES users (user_id);
+ALTER TABLE profiles ADD CONSTRAINT profiles_user_fk FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN ('active', 'closed'));
+-- NOT VALID: проверяются новые и изменённые строки, старые данные не блокируют миграцию
+ALTER TABLE orders ADD CONSTRAINT orders_category_check
+	CHECK (category IN ('design', 'programming', 'content')) NOT VALID;
+ALTER TABLE orders ADD CONSTRAINT orders_text_length_check CHECK (char_length(text) <= 100) NOT VALID;
+
+CREATE UNIQUE INDEX orders_one_active_per_creator ON orders (creator_id) WHERE status = 'active';
+CREATE INDEX orders_category_status_created_idx ON orders (category, status, created_at);
@@ -0,0 +1,7 @@
+DROP TABLE seen_updates;
+DROP TABLE group_members;
+DROP TABLE group_chats;
+DROP TABLE outbox;
+DROP TABLE users;
+DROP TABLE orders;
+DROP TABLE profiles;
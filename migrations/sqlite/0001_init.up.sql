@@ -0,0 +1,64 @@
+-- Исходная схема; версии и смысл миграций совпадают с migrations/postgres.
+-- Время хранится в секундах Unix.
+
+CREATE TABLE profiles (
+	user_id INTEGER PRIMARY KEY,
+	username TEXT,
+	description TEXT,
+	photo_file_id TEXT,
+	updated_at INTEGER DEFAULT (unixepoch())
+);
+CREATE TABLE orders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	creator_id INTEGER,
+	category TEXT,
+	text TEXT,
+	photo_file_id TEXT,
+	group_message_id INTEGER,
+	complaints INTEGER DEFAULT 0,
+	created_at INTEGER DEFAULT (unixepoch())
+);
+CREATE TABLE users (
+	user_id INTEGER PRIMARY KEY,
+	language TEXT NOT NULL DEFAULT '',
+	language_code TEXT NOT NULL DEFAULT '',
+	notify_categories TEXT NOT NULL DEFAULT '',
+	contact_visibility TEXT NOT NULL DEFAULT '',
+	hidden_from_search BOOLEAN NOT NULL DEFAULT FALSE,
+	unreachable BOOLEAN NOT NULL DEFAULT FALSE,
+	updated_at INTEGER DEFAULT (unixepoch())
+);
+CREATE TABLE outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	dedup_key TEXT NOT NULL UNIQUE,
+	chat_id INTEGER NOT NULL,
+	text TEXT NOT NULL DEFAULT '',
+	photo_file_id TEXT NOT NULL DEFAULT '',
+	parse_mode TEXT NOT NULL DEFAULT '',
+	reply_markup TEXT NOT NULL DEFAULT '',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	locked_until INTEGER,
+	created_at INTEGER DEFAULT (unixepoch()),
+	sent_at INTEGER,
+	failed_at INTEGER
+);
+CREATE INDEX outbox_pending_idx ON outbox (id) WHERE sent_at IS NULL AND failed_at IS NULL;
+CREATE TABLE group_chats (
+	chat_id INTEGER PRIMARY KEY,
+	title TEXT NOT NULL DEFAULT '',
+	bot_status TEXT NOT NULL DEFAULT '',
+	updated_at INTEGER DEFAULT (unixepoch())
+);
+CREATE TABLE group_members (
+	chat_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	updated_at INTEGER DEFAULT (unixepoch()),
+	PRIMARY KEY (chat_id, user_id)
+);
+CREATE TABLE seen_updates (
+	update_id INTEGER PRIMARY KEY,
+	seen_at INTEGER NOT NULL DEFAULT (unixepoch())
+);
+CREATE INDEX seen_updates_seen_at_idx ON seen_updates (seen_at);
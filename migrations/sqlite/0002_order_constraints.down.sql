@@ -0,0 +1,26 @@
+CREATE TABLE orders_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	creator_id INTEGER,
+	category TEXT,
+	text TEXT,
+	photo_file_id TEXT,
+	group_message_id INTEGER,
+	complaints INTEGER DEFAULT 0,
+	created_at INTEGER DEFAULT (unixepoch())
+);
+-- до 0002 закрытые анкеты удалялись
+INSERT INTO orders_old SELECT id, creator_id, category, text, photo_file_id, group_message_id, complaints, created_at
+FROM orders WHERE status = 'active';
+DROP TABLE orders;
+ALTER TABLE orders_old RENAME TO orders;
+
+CREATE TABLE profiles_old (
+	user_id INTEGER PRIMARY KEY,
+	username TEXT,
+	description TEXT,
+	photo_file_id TEXT,
+	updated_at INTEGER DEFAULT (unixepoch())
+);
+INSERT INTO profiles_old SELECT user_id, username, description, photo_file_id, updated_at FROM profiles;
+DROP TABLE profiles;
+ALTER TABLE profiles_old RENAME TO profiles;
@@ -0,0 +1,41 @@
+-- То же, что в Postgres: статус анкеты, одна активная анкета на создателя,
+-- внешние ключи на users и CHECK-ограничения. SQLite не умеет добавлять
+-- ограничения к существующей таблице, поэтому orders и profiles пересоздаются.
+
+INSERT OR IGNORE INTO users (user_id) SELECT DISTINCT creator_id FROM orders WHERE creator_id IS NOT NULL;
+INSERT OR IGNORE INTO users (user_id) SELECT user_id FROM profiles;
+
+CREATE TABLE orders_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	creator_id INTEGER NOT NULL CONSTRAINT orders_creator_fk REFERENCES users (user_id),
+	category TEXT CONSTRAINT orders_category_check CHECK (category IN ('design', 'programming', 'content')),
+	text TEXT CONSTRAINT orders_text_length_check CHECK (length(text) <= 100),
+	photo_file_id TEXT,
+	group_message_id INTEGER,
+	complaints INTEGER DEFAULT 0,
+	created_at INTEGER DEFAULT (unixepoch()),
+	status TEXT NOT NULL DEFAULT 'active' CONSTRAINT orders_status_check CHECK (status IN ('active', 'closed')),
+	closed_at INTEGER
+);
+-- из нескольких анкет одного создателя активной остаётся самая новая
+INSERT INTO orders_new (id, creator_id, category, text, photo_file_id, group_message_id, complaints, created_at, status, closed_at)
+SELECT id, creator_id, category, text, photo_file_id, group_message_id, complaints, created_at,
+	CASE WHEN EXISTS (SELECT 1 FROM orders n WHERE n.creator_id = o.creator_id AND n.id > o.id) THEN 'closed' ELSE 'active' END,
+	CASE WHEN EXISTS (SELECT 1 FROM orders n WHERE n.creator_id = o.creator_id AND n.id > o.id) THEN unixepoch() END
+FROM orders o WHERE creator_id IS NOT NULL;
+DROP TABLE orders;
+ALTER TABLE orders_new RENAME TO orders;
+
+CREATE TABLE profiles_new (
+	user_id INTEGER PRIMARY KEY CONSTRAINT profiles_user_fk REFERENCES users (user_id),
+	username TEXT,
+	description TEXT,
+	photo_file_id TEXT,
+	updated_at INTEGER DEFAULT (unixepoch())
+);
+INSERT INTO profiles_new SELECT user_id, username, description, photo_file_id, updated_at FROM profiles;
+DROP TABLE profiles;
+ALTER TABLE profiles_new RENAME TO profiles;
+
+CREATE UNIQUE INDEX orders_one_active_per_creator ON orders (creator_id) WHERE status = 'active';
+CREATE INDEX orders_category_status_created_idx ON orders (category, status, created_at);
@@ -1,10 +1,18 @@
 package main
 
+import "time"
+
+// Категории анкет
+var categories = []string{"design", "programming", "content"}
+
 type Profile struct {
 	UserID      int64  `json:"user_id"`
 	Username    string `json:"username"`
 	Description string `json:"description"`
 	PhotoFileID string `json:"photo_file_id"`
+	// UpdatedAt ведёт только JSON-хранилище для порядка выдачи в поиске;
+	// в SQL это колонка profiles.updated_at
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
 }
 
 type Order struct {
@@ -15,3 +23,84 @@ type Order struct {
 	PhotoFileID string `json:"photo_file_id"`
 	Complaints  int    `json:"complaints"`
 }
+
+// GroupChat — группа, в которой состоит бот, и его статус в ней (из my_chat_member)
+type GroupChat struct {
+	ChatID    int64     `json:"chat_id"`
+	Title     string    `json:"title"`
+	BotStatus string    `json:"bot_status"` // member, administrator, restricted, left, kicked
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Available сообщает, может ли бот писать в группу
+func (g GroupChat) Available() bool {
+	return g.BotStatus != "left" && g.BotStatus != "kicked"
+}
+
+// OrderStats — число анкет и жалоб на них в категории (для метрик)
+type OrderStats struct {
+	Category   string
+	Orders     int
+	Complaints int
+}
+
+// Видимость контакта исполнителя для клиентов
+const (
+	contactUsername = "username" // показывать @username
+	contactRelay    = "relay"    // только переписка через бота
+)
+
+// User хранит язык и настройки пользователя (/settings).
+// Нулевые значения полей соответствуют настройкам по умолчанию.
+type User struct {
+	UserID            int64    `json:"user_id"`
+	Language          string   `json:"language"`           // выбран через /language; пусто — автоопределение
+	LanguageCode      string   `json:"language_code"`      // language_code из Telegram
+	NotifyCategories  []string `json:"notify_categories"`  // категории, о новых анкетах которых пользователь просил сообщать
+	ContactVisibility string   `json:"contact_visibility"` // contactUsername (по умолчанию) или contactRelay
+	HiddenFromSearch  bool     `json:"hidden_from_search"` // не показывать профиль в поиске клиентов
+	Unreachable       bool     `json:"unreachable"`        // заблокировал бота (my_chat_member kicked)
+	Banned            bool     `json:"banned,omitempty"`   // заблокирован админом через /ban
+}
+
+// Lang возвращает язык интерфейса пользователя
+func (u User) Lang() string {
+	if u.Language != "" {
+		return u.Language
+	}
+	return normalizeLang(u.LanguageCode)
+}
+
+// NotifiesAbout сообщает, подписался ли пользователь на новые анкеты категории;
+// по умолчанию уведомления выключены
+func (u User) NotifiesAbout(category string) bool {
+	for _, c := range u.NotifyCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// RelayOnly — контакт пользователя скрыт, связь только через бота
+func (u User) RelayOnly() bool {
+	return u.ContactVisibility == contactRelay
+}
+
+// OutboxMessage — исходящее сообщение, сохранённое в той же транзакции, что и
+// изменение состояния, которое его вызвало. Доставляется диспетчером outbox
+// как минимум один раз; DedupKey не даёт поставить одно уведомление дважды.
+type OutboxMessage struct {
+	ID          int64     `json:"id"`
+	DedupKey    string    `json:"dedup_key"`
+	ChatID      int64     `json:"chat_id"`
+	Text        string    `json:"text"`
+	PhotoFileID string    `json:"photo_file_id"`
+	ParseMode   string    `json:"parse_mode"`
+	ReplyMarkup string    `json:"reply_markup"` // JSON InlineKeyboardMarkup
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	LockedUntil time.Time `json:"locked_until"`
+	SentAt      time.Time `json:"sent_at"`
+	FailedAt    time.Time `json:"failed_at"`
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Outbox ------------------------
+// Важные уведомления (анкета удалена, анкету приняли, новая анкета в категории)
+// не должны теряться при падении или деплое, поэтому они пишутся в outbox
+// вместе с изменением состояния, а не в messagesChan. Диспетчер арендует
+// пачки сообщений, отправляет их через outboundSender и отмечает отправленными.
+// Доставка — at least once: если процесс упадёт между отправкой и отметкой,
+// сообщение уйдёт ещё раз после истечения аренды.
+
+const (
+	outboxBatch       = 50
+	outboxLease       = time.Minute
+	outboxPoll        = 5 * time.Second
+	outboxMaxAttempts = 10
+	// outboxRetention — сколько хранятся отправленные и отклонённые сообщения.
+	// Пока запись есть, повторное сообщение с тем же DedupKey не ставится в
+	// очередь; потом её удаляет PruneOutbox (в JSON — ещё и сжатие журнала).
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+var outboxWake = make(chan struct{}, 1)
+
+// wakeOutbox будит диспетчер после записи в outbox, не дожидаясь опроса
+func wakeOutbox() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// runOutboxDispatcher доставляет сообщения из outbox до отмены ctx
+func runOutboxDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(outboxPoll)
+	defer ticker.Stop()
+	for {
+		batch, err := storage.ClaimOutbox(ctx, outboxBatch, outboxLease)
+		if err != nil {
+			slog.Error("outbox claim", slog.Any("err", err))
+		}
+		// пачка отправляется через очереди чатов параллельно; следующую
+		// арендуем, когда разобрана эта
+		var wg sync.WaitGroup
+		for _, m := range batch {
+			if ctx.Err() != nil {
+				break
+			}
+			deliverOutbox(ctx, m, &wg)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+		if len(batch) == outboxBatch {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-outboxWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func outboxLog(m OutboxMessage) *slog.Logger {
+	return slog.With(slog.Int64("outbox_id", m.ID), slog.String("dedup_key", m.DedupKey))
+}
+
+// deliverOutbox ставит сообщение в очередь его чата; wg завершается, когда
+// итог отправки записан в outbox
+func deliverOutbox(ctx context.Context, m OutboxMessage, wg *sync.WaitGroup) {
+	msg, err := m.chattable()
+	if err != nil {
+		outboxLog(m).Error("outbox: bad message", slog.Any("err", err))
+		markCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		_ = storage.MarkOutboxFailed(markCtx, m.ID, err.Error())
+		return
+	}
+	wg.Add(1)
+	err = outbound.Submit(ctx, msg, func(err error) {
+		defer wg.Done()
+		finishOutbox(ctx, m, err)
+	})
+	if err != nil {
+		// остановка: аренда истечёт, и сообщение подберут после рестарта
+		wg.Done()
+	}
+}
+
+// finishOutbox отмечает итог отправки сообщения outbox
+func finishOutbox(ctx context.Context, m OutboxMessage, err error) {
+	// отметку об отправке не прерываем при остановке, иначе сообщение уйдёт повторно
+	markCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	switch {
+	case err == nil:
+		if err := storage.MarkOutboxSent(markCtx, m.ID); err != nil {
+			// сообщение уйдёт повторно после истечения аренды
+			outboxLog(m).Error("outbox: mark sent", slog.Any("err", err))
+		}
+	case ctx.Err() != nil:
+		// остановка: аренда истечёт, и сообщение подберут после рестарта
+	case errors.Is(err, errPermanentSend) || m.Attempts >= outboxMaxAttempts:
+		if err := storage.MarkOutboxFailed(markCtx, m.ID, err.Error()); err != nil {
+			outboxLog(m).Error("outbox: mark failed", slog.Any("err", err))
+		}
+	default:
+		outboxLog(m).Warn("outbox: attempt failed", slog.Int("attempt", m.Attempts), slog.Any("err", err))
+	}
+}
+
+// finishedBefore — сообщение отправлено или отклонено раньше t
+func (m OutboxMessage) finishedBefore(t time.Time) bool {
+	return (!m.SentAt.IsZero() && m.SentAt.Before(t)) || (!m.FailedAt.IsZero() && m.FailedAt.Before(t))
+}
+
+// chattable восстанавливает сообщение Telegram из записи outbox
+func (m OutboxMessage) chattable() (tgbot.Chattable, error) {
+	var markup *tgbot.InlineKeyboardMarkup
+	if m.ReplyMarkup != "" {
+		markup = &tgbot.InlineKeyboardMarkup{}
+		if err := json.Unmarshal([]byte(m.ReplyMarkup), markup); err != nil {
+			return nil, err
+		}
+	}
+	if m.PhotoFileID != "" {
+		photo := tgbot.NewPhoto(m.ChatID, tgbot.FileID(m.PhotoFileID))
+		photo.Caption = m.Text
+		photo.ParseMode = m.ParseMode
+		if markup != nil {
+			photo.ReplyMarkup = *markup
+		}
+		return photo, nil
+	}
+	msg := tgbot.NewMessage(m.ChatID, m.Text)
+	msg.ParseMode = m.ParseMode
+	msg.DisableWebPagePreview = true
+	if markup != nil {
+		msg.ReplyMarkup = *markup
+	}
+	return msg, nil
+}
+
+// outboxText — текстовое уведомление для outbox
+func outboxText(key string, chatID int64, text string) OutboxMessage {
+	return OutboxMessage{DedupKey: key, ChatID: chatID, Text: truncateRunes(text, maxMessageLen)}
+}
+
+// outboxCard — HTML-карточка для outbox, аналог sendCard
+func outboxCard(key string, chatID int64, photoFileID, text string, markup *tgbot.InlineKeyboardMarkup) OutboxMessage {
+	m := OutboxMessage{DedupKey: key, ChatID: chatID, PhotoFileID: photoFileID, ParseMode: tgbot.ModeHTML}
+	if photoFileID != "" {
+		m.Text = truncateHTML(text, maxCaptionLen)
+	} else {
+		m.Text = truncateHTML(text, maxMessageLen)
+	}
+	if markup != nil {
+		b, _ := json.Marshal(markup)
+		m.ReplyMarkup = string(b)
+	}
+	return m
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Long polling ------------------------
+// В режиме MODE=polling апдейты забираются через getUpdates и попадают в тот же
+// updatesChan, что и апдейты вебхука, так что обработка не отличается.
+
+const pollTimeout = 30 // секунд, long polling на стороне Telegram
+
+// startPolling удаляет вебхук (иначе getUpdates вернёт 409) и запускает цикл
+// getUpdates с отслеживанием offset. Цикл завершается при отмене ctx.
+func startPolling(ctx context.Context, b *Bot) error {
+	if err := b.DeleteWebhook(false); err != nil {
+		return err
+	}
+	go func() {
+		offset := 0
+		backoff := time.Second
+		for ctx.Err() == nil {
+			updates, err := b.api.GetUpdates(tgbot.UpdateConfig{Offset: offset, Timeout: pollTimeout, AllowedUpdates: allowedUpdates})
+			if err != nil {
+				slog.Warn("getUpdates failed", slog.Any("err", err), slog.Duration("retry_in", backoff))
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return
+				}
+				if backoff < time.Minute {
+					backoff *= 2
+				}
+				continue
+			}
+			backoff = time.Second
+			markTelegramOK()
+			for i := range updates {
+				countUpdate(&updates[i])
+				// при остановке апдейт не ставим в очередь: offset ещё не
+				// подтверждён следующим getUpdates, и Telegram отдаст его снова
+				if ctx.Err() != nil || !enqueueUpdate(ctx, &updates[i]) {
+					return
+				}
+				offset = updates[i].UpdateID + 1
+			}
+		}
+	}()
+	return nil
+}
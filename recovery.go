@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Update panic recovery ------------------------
+// Паника в обработчике апдейта не должна ронять процесс: recoverUpdate ловит
+// её в воркере, пишет стек в лог, увеличивает метрику и вежливо отвечает
+// пользователю. Чтобы один «ядовитый» апдейт или пользователь не валил
+// воркеры раз за разом, ключ упорядочивания (обычно user ID), на котором
+// обработчик паниковал quarantineThreshold раз за quarantineWindow, попадает
+// в карантин на quarantineFor: его апдейты отбрасываются без обработки.
+
+const (
+	quarantineThreshold = 3
+	quarantineWindow    = 10 * time.Minute
+	quarantineFor       = 30 * time.Minute
+)
+
+type panicRecord struct {
+	count int
+	first time.Time
+	until time.Time
+}
+
+var quarantine = struct {
+	mu sync.Mutex
+	m  map[int64]*panicRecord
+}{m: map[int64]*panicRecord{}}
+
+// quarantined сообщает, что апдейты с этим ключом сейчас отбрасываются
+func quarantined(key int64) bool {
+	quarantine.mu.Lock()
+	defer quarantine.mu.Unlock()
+	rec, ok := quarantine.m[key]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if !rec.until.IsZero() && now.Before(rec.until) {
+		return true
+	}
+	if now.Sub(rec.first) > quarantineWindow && now.After(rec.until) {
+		delete(quarantine.m, key)
+	}
+	return false
+}
+
+// notePanic учитывает панику по ключу и возвращает true, если ключ ушёл в карантин
+func notePanic(key int64) bool {
+	quarantine.mu.Lock()
+	defer quarantine.mu.Unlock()
+	now := time.Now()
+	rec, ok := quarantine.m[key]
+	if !ok || now.Sub(rec.first) > quarantineWindow {
+		rec = &panicRecord{first: now}
+		quarantine.m[key] = rec
+	}
+	rec.count++
+	if rec.count >= quarantineThreshold {
+		rec.until = now.Add(quarantineFor)
+		return true
+	}
+	return false
+}
+
+// recoverUpdate вызывается через defer в processUpdate
+func recoverUpdate(ctx context.Context, b *Bot, upd *tgbot.Update) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	updatePanicsTotal.WithLabelValues(updateType(upd)).Inc()
+	key := updateKey(upd)
+	isolated := notePanic(key)
+	logger(ctx).Error("panic in update handler",
+		slog.Any("panic", rec),
+		slog.String("stack", string(debug.Stack())),
+		slog.Bool("quarantined", isolated))
+	apologize(ctx, b, upd)
+}
+
+// apologize отвечает пользователю, что запрос не удался; сам ответ тоже
+// защищён от паники, чтобы не уронить воркер повторно
+func apologize(ctx context.Context, b *Bot, upd *tgbot.Update) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger(ctx).Error("panic while apologizing", slog.Any("panic", rec))
+		}
+	}()
+	from := upd.SentFrom()
+	lang := defaultLang
+	if from != nil {
+		lang = langOf(ctx, from.ID)
+	}
+	text := T(lang, "error.internal")
+	if q := upd.CallbackQuery; q != nil {
+		b.api.Request(tgbot.NewCallbackWithAlert(q.ID, text))
+		return
+	}
+	if chat := updateChat(upd); chat != nil && chat.IsPrivate() {
+		sendText(b, chat.ID, text)
+	}
+}
+
+// dropQuarantined пишет в лог и метрику отброшенный апдейт
+func dropQuarantined(ctx context.Context, upd *tgbot.Update) {
+	quarantinedUpdatesTotal.Inc()
+	logger(ctx).Warn("update dropped: key in quarantine", slog.Int64("key", updateKey(upd)))
+}
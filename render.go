@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Лимиты Telegram на длину текста сообщения и подписи к фото
+const (
+	maxMessageLen  = 4096
+	maxCaptionLen  = 1024
+	maxCardTextLen = 100
+)
+
+// ------------------------ Profiles ------------------------
+
+// sendProfileToChat отправляет карточку профиля: фото с подписью, если оно есть, иначе текст
+func sendProfileToChat(b *Bot, chatID int64, lang string, p Profile) {
+	sendCard(chatID, p.PhotoFileID, renderProfile(lang, p), nil)
+}
+
+// renderProfile собирает HTML-карточку профиля; пользовательский текст экранируется.
+// Пустые Username и UserID не выводятся — так скрывается контакт.
+func renderProfile(lang string, p Profile) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<b>%s</b>\n", T(lang, "card.profile_title"))
+	if p.Username != "" {
+		fmt.Fprintf(&sb, "👤 @%s\n", escapeHTML(p.Username))
+	}
+	if p.UserID != 0 {
+		fmt.Fprintf(&sb, "🆔 <code>%d</code>\n", p.UserID)
+	}
+	if d := strings.TrimSpace(p.Description); d != "" {
+		fmt.Fprintf(&sb, "\n%s\n", escapeHTML(d))
+	}
+	photo := T(lang, "card.photo_no")
+	if p.PhotoFileID != "" {
+		photo = T(lang, "card.photo_yes")
+	}
+	sb.WriteString("\n" + T(lang, "card.profile_stats", utf8.RuneCountInString(p.Description), maxCardTextLen, photo))
+	return sb.String()
+}
+
+// ------------------------ Orders ------------------------
+
+// sendOrderToChat отправляет карточку анкеты с необязательной inline-клавиатурой
+func sendOrderToChat(b *Bot, chatID int64, lang string, o Order, markup *tgbot.InlineKeyboardMarkup) {
+	sendCard(chatID, o.PhotoFileID, renderOrder(lang, o), markup)
+}
+
+// renderOrder собирает HTML-карточку анкеты клиента
+func renderOrder(lang string, o Order) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<b>%s %s</b>\n", categoryEmoji(o.Category), T(lang, "card.order_title", o.ID))
+	sb.WriteString(T(lang, "card.category", escapeHTML(categoryTitle(lang, o.Category))) + "\n")
+	if t := strings.TrimSpace(o.Text); t != "" {
+		fmt.Fprintf(&sb, "\n%s\n", escapeHTML(t))
+	}
+	sb.WriteString("\n" + Tn(lang, "card.complaints", o.Complaints))
+	return sb.String()
+}
+
+// categoryTitle возвращает человекочитаемое название категории
+func categoryTitle(lang, cat string) string {
+	switch cat {
+	case "design", "programming", "content":
+		return T(lang, "category."+cat)
+	default:
+		return cat
+	}
+}
+
+// ------------------------ Helpers ------------------------
+
+// sendCard отправляет HTML-карточку как фото с подписью или как обычное сообщение
+func sendCard(chatID int64, photoFileID, text string, markup *tgbot.InlineKeyboardMarkup) {
+	if photoFileID != "" {
+		photo := tgbot.NewPhoto(chatID, tgbot.FileID(photoFileID))
+		photo.Caption = truncateHTML(text, maxCaptionLen)
+		photo.ParseMode = tgbot.ModeHTML
+		if markup != nil {
+			photo.ReplyMarkup = *markup
+		}
+		sendMessage(photo)
+		return
+	}
+	msg := tgbot.NewMessage(chatID, truncateHTML(text, maxMessageLen))
+	msg.ParseMode = tgbot.ModeHTML
+	msg.DisableWebPagePreview = true
+	if markup != nil {
+		msg.ReplyMarkup = *markup
+	}
+	sendMessage(msg)
+}
+
+// escapeHTML экранирует пользовательский ввод для ParseMode HTML
+func escapeHTML(s string) string {
+	return html.EscapeString(s)
+}
+
+// truncateRunes обрезает простой текст до n символов, не разрывая UTF-8
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// truncateHTML обрезает HTML-текст до n видимых символов (Telegram считает длину
+// после разбора разметки). Резать можно только между тегами и сущностями:
+// разорванный "<b" или "&am" Telegram отклоняет с "can't parse entities".
+// Незакрытые к месту обрезки теги закрываются.
+func truncateHTML(s string, n int) string {
+	if htmlTextLen(s) <= n {
+		return s
+	}
+	var sb strings.Builder
+	var open []string
+	visible := 0
+	for i := 0; i < len(s); {
+		tok, isTag := nextHTMLToken(s[i:])
+		if isTag {
+			name := strings.Trim(strings.Fields(tok)[0], "</>")
+			if strings.HasPrefix(tok, "</") {
+				if k := len(open) - 1; k >= 0 && open[k] == name {
+					open = open[:k]
+				}
+			} else {
+				open = append(open, name)
+			}
+		} else {
+			if visible == n-1 {
+				break
+			}
+			visible++
+		}
+		sb.WriteString(tok)
+		i += len(tok)
+	}
+	sb.WriteString("…")
+	for k := len(open) - 1; k >= 0; k-- {
+		sb.WriteString("</" + open[k] + ">")
+	}
+	return sb.String()
+}
+
+// htmlTextLen — число видимых символов HTML-текста: теги не считаются, сущность — один символ
+func htmlTextLen(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		tok, isTag := nextHTMLToken(s[i:])
+		if !isTag {
+			n++
+		}
+		i += len(tok)
+	}
+	return n
+}
+
+// nextHTMLToken возвращает начало s: тег целиком, сущность целиком или один символ
+func nextHTMLToken(s string) (tok string, isTag bool) {
+	switch s[0] {
+	case '<':
+		if j := strings.IndexByte(s, '>'); j > 0 {
+			return s[:j+1], true
+		}
+	case '&':
+		if j := strings.IndexByte(s, ';'); j > 0 && !strings.ContainsAny(s[1:j], " <&") {
+			return s[:j+1], false
+		}
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size], false
+}
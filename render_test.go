@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		n    int
+		want string
+	}{
+		{"короче лимита", "<b>abc</b>", 3, "<b>abc</b>"},
+		{"теги не считаются", "<b>abc</b>\nde", 6, "<b>abc</b>\nde"},
+		{"закрывает открытый тег", "<b>abcdef</b>", 4, "<b>abc…</b>"},
+		{"не режет сущность", "a&amp;b&lt;cd", 4, "a&amp;b…"},
+		{"сущность — один символ", "&lt;&gt;&amp;", 3, "&lt;&gt;&amp;"},
+		{"не режет тег", "abc<code>123</code>", 4, "abc<code>…</code>"},
+		{"вложенные теги", "<b><i>abcdef</i></b>", 3, "<b><i>ab…</i></b>"},
+		{"после закрытого тега", "<b>ab</b>cdef", 4, "<b>ab</b>c…"},
+		{"кириллица", "<b>привет</b>", 3, "<b>пр…</b>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateHTML(tt.in, tt.n)
+			if got != tt.want {
+				t.Fatalf("truncateHTML(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+			}
+			if l := htmlTextLen(got); l > tt.n {
+				t.Fatalf("visible length %d > %d", l, tt.n)
+			}
+		})
+	}
+}
+
+func TestRenderOrderLongTextFitsLimit(t *testing.T) {
+	// экранированный пользовательский текст с сущностями на каждой позиции обрезки
+	o := Order{ID: 1, Category: "design", Text: strings.Repeat("<&>", 2000)}
+	got := truncateHTML(renderOrder(langRU, o), maxCaptionLen)
+	if l := htmlTextLen(got); l > maxCaptionLen {
+		t.Fatalf("caption has %d visible characters, limit %d", l, maxCaptionLen)
+	}
+	if !utf8.ValidString(got) {
+		t.Fatal("caption is not valid UTF-8")
+	}
+	tail := got[strings.LastIndex(got, ";")+1:]
+	if strings.Contains(tail, "&") {
+		t.Fatalf("caption ends with a cut entity: %q", tail)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Outbound scheduler ------------------------
+// Все исходящие сообщения проходят через outboundSender:
+//   - глобальный token bucket — лимит Telegram 30 сообщений/сек на бота;
+//   - bucket на каждый чат — 20 сообщений/мин в группу, ~1/сек в личку;
+//   - 429 — ждём retry_after и ставим чат на паузу;
+//   - 5xx и сетевые ошибки — повтор с экспоненциальной задержкой;
+//   - остальные ошибки и исчерпанные попытки — запись в dead-letter лог.
+//
+// У каждого чата своя очередь и своя горутина, как у шардов апдейтов: ожидание
+// лимита или паузы после 429 задерживает только этот чат, порядок сообщений
+// в чате сохраняется. SendWorkers ограничивает число одновременных запросов к
+// Telegram; слот занимается только на время запроса, а не ожидания.
+
+const (
+	globalSendRate   = 30.0
+	globalSendBurst  = 30
+	groupSendRate    = 20.0 / 60
+	groupSendBurst   = 5
+	privateSendRate  = 1.0
+	privateSendBurst = 5
+
+	sendMaxAttempts = 5
+	sendBackoffMax  = 30 * time.Second
+
+	chatBucketTTL = 10 * time.Minute
+)
+
+// sendBackoffBase — задержка перед первым повтором после 5xx, дальше удваивается
+var sendBackoffBase = 500 * time.Millisecond
+
+// errPermanentSend — Telegram отклонил сообщение так, что повтор не поможет (400, 403)
+var errPermanentSend = errors.New("permanent send error")
+
+// tokenBucket — простой token bucket с резервированием: токен берётся сразу,
+// а вызывающий ждёт столько, сколько нужно для его накопления
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // токенов в секунду
+	burst  float64
+	tokens float64
+	last   time.Time
+	until  time.Time // пауза после 429
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+	tb.tokens--
+	var wait time.Duration
+	if tb.tokens < 0 {
+		wait = time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	}
+	if pause := tb.until.Sub(now); pause > wait {
+		wait = pause
+	}
+	return wait
+}
+
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	d := tb.reserve(time.Now())
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pause запрещает отправку до момента until (retry_after от Telegram)
+func (tb *tokenBucket) pause(until time.Time) {
+	tb.mu.Lock()
+	if until.After(tb.until) {
+		tb.until = until
+	}
+	tb.mu.Unlock()
+}
+
+// sendJob — сообщение в очереди чата; done (может быть nil) получает итог отправки
+type sendJob struct {
+	ctx  context.Context
+	msg  tgbot.Chattable
+	done func(error)
+}
+
+// chatQueue — очередь и лимит одного чата; поля, кроме bucket, под outboundSender.mu
+type chatQueue struct {
+	bucket   *tokenBucket // nil для сообщений без чата
+	jobs     []sendJob
+	running  bool // горутина drain разбирает очередь
+	lastUsed time.Time
+}
+
+type outboundSender struct {
+	bot       *Bot
+	global    *tokenBucket
+	requests  chan struct{} // слоты одновременных запросов к Telegram
+	pending   chan struct{} // слоты сообщений в очередях чатов (backpressure)
+	mu        sync.Mutex
+	chats     map[int64]*chatQueue
+	lastSweep time.Time
+	wg        sync.WaitGroup
+
+	dlMu       sync.Mutex
+	deadLetter *log.Logger
+	dlFile     *os.File // nil, если dead-letter лог пишется в stderr
+}
+
+// outbound создаётся в startWorkers
+var outbound *outboundSender
+
+func newOutboundSender(b *Bot, workers, queueSize int, deadLetterPath string) *outboundSender {
+	s := &outboundSender{
+		bot:        b,
+		global:     newTokenBucket(globalSendRate, globalSendBurst),
+		requests:   make(chan struct{}, workers),
+		pending:    make(chan struct{}, queueSize),
+		chats:      map[int64]*chatQueue{},
+		lastSweep:  time.Now(),
+		deadLetter: log.New(os.Stderr, "dead-letter: ", log.LstdFlags),
+	}
+	if deadLetterPath != "" {
+		f, err := os.OpenFile(deadLetterPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			slog.Error("open dead-letter log, using stderr", slog.String("path", deadLetterPath), slog.Any("err", err))
+		} else {
+			s.deadLetter = log.New(f, "", 0)
+			s.dlFile = f
+		}
+	}
+	return s
+}
+
+// queue возвращает очередь чата; вызывается под s.mu. Пустые очереди,
+// простаивающие дольше chatBucketTTL, удаляются вместе с лимитом чата.
+func (s *outboundSender) queue(chatID int64) *chatQueue {
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for id, q := range s.chats {
+			if !q.running && now.Sub(q.lastUsed) > chatBucketTTL {
+				delete(s.chats, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	q, ok := s.chats[chatID]
+	if !ok {
+		q = &chatQueue{}
+		if chatID != 0 {
+			rate, burst := privateSendRate, privateSendBurst
+			if chatID < 0 {
+				rate, burst = groupSendRate, groupSendBurst
+			}
+			q.bucket = newTokenBucket(rate, burst)
+		}
+		s.chats[chatID] = q
+	}
+	q.lastUsed = now
+	return q
+}
+
+// Submit ставит сообщение в очередь его чата и возвращается, не дожидаясь
+// отправки; done вызывается с её итогом. Ждёт только места в очередях —
+// ошибка означает отмену ctx, и тогда done не вызывается.
+func (s *outboundSender) Submit(ctx context.Context, msg tgbot.Chattable, done func(error)) error {
+	select {
+	case s.pending <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	chatID := chatIDOf(msg)
+	s.mu.Lock()
+	q := s.queue(chatID)
+	q.jobs = append(q.jobs, sendJob{ctx: ctx, msg: msg, done: done})
+	if !q.running {
+		q.running = true
+		s.wg.Add(1)
+		go s.drain(chatID, q)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// drain отправляет сообщения чата по порядку, пока очередь не опустеет
+func (s *outboundSender) drain(chatID int64, q *chatQueue) {
+	defer s.wg.Done()
+	for {
+		s.mu.Lock()
+		if len(q.jobs) == 0 {
+			q.running = false
+			q.lastUsed = time.Now()
+			s.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs[0] = sendJob{}
+		q.jobs = q.jobs[1:]
+		s.mu.Unlock()
+		err := s.deliver(job.ctx, chatID, q.bucket, job.msg)
+		<-s.pending
+		if job.done != nil {
+			job.done(err)
+		}
+	}
+}
+
+// wait ждёт, пока очереди чатов разберут уже поставленные сообщения
+func (s *outboundSender) wait(ctx context.Context) error {
+	return waitWG(ctx, &s.wg)
+}
+
+// deliver отправляет сообщение с учётом лимитов и повторов; вызывается только
+// из drain, поэтому ожидание лимита чата задерживает лишь этот чат
+func (s *outboundSender) deliver(ctx context.Context, chatID int64, chat *tokenBucket, msg tgbot.Chattable) error {
+	var lastErr error
+	for attempt := 1; attempt <= sendMaxAttempts; attempt++ {
+		if chat != nil {
+			if err := chat.wait(ctx); err != nil {
+				return err
+			}
+		}
+		if err := s.global.wait(ctx); err != nil {
+			return err
+		}
+		select {
+		case s.requests <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		_, err := s.bot.api.Request(msg)
+		<-s.requests
+		sendAttemptsTotal.WithLabelValues(sendErrorCode(err)).Inc()
+		if err == nil {
+			markTelegramOK()
+			return nil
+		}
+		lastErr = err
+
+		var delay time.Duration
+		var apiErr *tgbot.Error
+		switch {
+		case errors.As(err, &apiErr) && apiErr.Code == 429:
+			delay = time.Duration(apiErr.RetryAfter) * time.Second
+			if delay <= 0 {
+				delay = time.Second
+			}
+			if chat != nil {
+				// следующая итерация подождёт паузу в bucket чата, вместе
+				// с остальными сообщениями в этот чат
+				chat.pause(time.Now().Add(delay))
+				delay = 0
+			}
+		case errors.As(err, &apiErr) && apiErr.Code < 500:
+			// 400/403 и т.п. — повтор не поможет
+			return s.dead(msg, chatID, attempt, fmt.Errorf("%w: %w", errPermanentSend, err))
+		default:
+			// 5xx или сетевая ошибка
+			delay = sendBackoffBase << (attempt - 1)
+			if delay > sendBackoffMax {
+				delay = sendBackoffMax
+			}
+		}
+		if attempt == sendMaxAttempts || delay <= 0 {
+			continue
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+	return s.dead(msg, chatID, sendMaxAttempts, lastErr)
+}
+
+// closeDeadLetter сбрасывает на диск и закрывает файл dead-letter лога.
+// Запоздавшие после этого записи уходят в stderr.
+func (s *outboundSender) closeDeadLetter() error {
+	s.dlMu.Lock()
+	defer s.dlMu.Unlock()
+	if s.dlFile == nil {
+		return nil
+	}
+	f := s.dlFile
+	s.dlFile = nil
+	s.deadLetter = log.New(os.Stderr, "dead-letter: ", log.LstdFlags)
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dead пишет неотправленное сообщение в dead-letter лог одной JSON-строкой
+func (s *outboundSender) dead(msg tgbot.Chattable, chatID int64, attempts int, err error) error {
+	sendFailuresTotal.WithLabelValues(sendErrorCode(err)).Inc()
+	rec := struct {
+		Time     time.Time       `json:"time"`
+		ChatID   int64           `json:"chat_id"`
+		Type     string          `json:"type"`
+		Attempts int             `json:"attempts"`
+		Error    string          `json:"error"`
+		Message  tgbot.Chattable `json:"message"`
+	}{time.Now(), chatID, fmt.Sprintf("%T", msg), attempts, err.Error(), msg}
+	b, mErr := json.Marshal(rec)
+	s.dlMu.Lock()
+	if mErr != nil {
+		s.deadLetter.Printf("chat=%d type=%T attempts=%d error=%v", chatID, msg, attempts, err)
+	} else {
+		s.deadLetter.Println(string(b))
+	}
+	s.dlMu.Unlock()
+	return fmt.Errorf("send to %d failed after %d attempts: %w", chatID, attempts, err)
+}
+
+// chatIDOf достаёт чат получателя из поддерживаемых типов сообщений
+func chatIDOf(msg tgbot.Chattable) int64 {
+	switch m := msg.(type) {
+	case tgbot.MessageConfig:
+		return m.ChatID
+	case tgbot.PhotoConfig:
+		return m.ChatID
+	case tgbot.EditMessageTextConfig:
+		return m.ChatID
+	case tgbot.EditMessageReplyMarkupConfig:
+		return m.ChatID
+	case tgbot.EditMessageCaptionConfig:
+		return m.ChatID
+	case tgbot.DeleteMessageConfig:
+		return m.ChatID
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeTelegram — Bot API, который запоминает sendMessage по чатам и отвечает
+// ошибкой, если её вернула reply
+type fakeTelegram struct {
+	mu    sync.Mutex
+	sent  map[int64][]string
+	calls map[int64]int
+	reply func(chatID int64, call int) (code, retryAfter int)
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(r.URL.Path, "/getMe") {
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`)
+		return
+	}
+	r.ParseForm()
+	chatID, _ := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+	f.mu.Lock()
+	f.calls[chatID]++
+	call := f.calls[chatID]
+	code, retryAfter := 0, 0
+	if f.reply != nil {
+		code, retryAfter = f.reply(chatID, call)
+	}
+	if code == 0 {
+		f.sent[chatID] = append(f.sent[chatID], r.Form.Get("text"))
+	}
+	f.mu.Unlock()
+	if code != 0 {
+		fmt.Fprintf(w, `{"ok":false,"error_code":%d,"description":"error %d","parameters":{"retry_after":%d}}`, code, code, retryAfter)
+		return
+	}
+	fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":%d}}}`, call, chatID)
+}
+
+func newTestSender(t *testing.T, f *fakeTelegram, deadLetterPath string) *outboundSender {
+	t.Helper()
+	f.sent = map[int64][]string{}
+	f.calls = map[int64]int{}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	api, err := tgbot.NewBotAPIWithClient("TOKEN", srv.URL+"/bot%s/%s", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newOutboundSender(&Bot{api: api}, 4, 100, deadLetterPath)
+	t.Cleanup(func() { s.closeDeadLetter() })
+	return s
+}
+
+func TestSenderPerChatOrder(t *testing.T) {
+	f := &fakeTelegram{}
+	s := newTestSender(t, f, "")
+	ctx := context.Background()
+	chats := []int64{1, 2, -100}
+	for i := 0; i < 5; i++ {
+		for _, chat := range chats {
+			if err := s.Submit(ctx, tgbot.NewMessage(chat, strconv.Itoa(i)), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := s.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// пять сообщений укладываются в burst каждого чата
+	for _, chat := range chats {
+		got := f.sent[chat]
+		if len(got) != 5 {
+			t.Fatalf("chat %d: sent %d messages, want 5", chat, len(got))
+		}
+		for i, text := range got {
+			if text != strconv.Itoa(i) {
+				t.Fatalf("chat %d: got %v, want messages in submit order", chat, got)
+			}
+		}
+	}
+}
+
+func TestSenderRetryAfter(t *testing.T) {
+	f := &fakeTelegram{reply: func(chatID int64, call int) (int, int) {
+		if chatID == 1 && call == 1 {
+			return 429, 1
+		}
+		return 0, 0
+	}}
+	s := newTestSender(t, f, "")
+	ctx := context.Background()
+
+	type result struct {
+		chat int64
+		err  error
+		at   time.Duration
+	}
+	results := make(chan result, 3)
+	start := time.Now()
+	submit := func(chat int64, text string) {
+		err := s.Submit(ctx, tgbot.NewMessage(chat, text), func(err error) {
+			results <- result{chat, err, time.Since(start)}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	submit(1, "a")
+	submit(1, "b")
+	submit(2, "c")
+
+	var chat1 []time.Duration
+	for i := 0; i < 3; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("chat %d: %v", r.chat, r.err)
+		}
+		switch r.chat {
+		case 1:
+			chat1 = append(chat1, r.at)
+		case 2:
+			// пауза после 429 касается только чата 1
+			if r.at > 500*time.Millisecond {
+				t.Fatalf("chat 2 delivered after %v, blocked by chat 1's retry_after", r.at)
+			}
+		}
+	}
+	for _, at := range chat1 {
+		if at < time.Second {
+			t.Fatalf("chat 1 delivered after %v, before retry_after elapsed", at)
+		}
+	}
+	if got := f.sent[1]; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("chat 1 got %v, want [a b]", got)
+	}
+	if f.calls[1] != 3 {
+		t.Fatalf("chat 1: %d requests, want 3 (one rejected with 429)", f.calls[1])
+	}
+}
+
+func TestSenderDeadLetter(t *testing.T) {
+	defer func(d time.Duration) { sendBackoffBase = d }(sendBackoffBase)
+	sendBackoffBase = time.Millisecond
+	tests := []struct {
+		name      string
+		code      int
+		wantCalls int
+		permanent bool
+	}{
+		{"403 не повторяется", 403, 1, true},
+		{"400 не повторяется", 400, 1, true},
+		{"5xx до исчерпания попыток", 502, sendMaxAttempts, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeTelegram{reply: func(int64, int) (int, int) { return tt.code, 0 }}
+			path := filepath.Join(t.TempDir(), "dead.log")
+			s := newTestSender(t, f, path)
+			done := make(chan error, 1)
+			if err := s.Submit(context.Background(), tgbot.NewMessage(7, "x"), func(err error) { done <- err }); err != nil {
+				t.Fatal(err)
+			}
+			err := <-done
+			if err == nil || errors.Is(err, errPermanentSend) != tt.permanent {
+				t.Fatalf("err = %v, permanent %v", err, tt.permanent)
+			}
+			if f.calls[7] != tt.wantCalls {
+				t.Fatalf("%d requests, want %d", f.calls[7], tt.wantCalls)
+			}
+			if err := s.closeDeadLetter(); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(b), `"chat_id":7`) {
+				t.Fatalf("dead-letter log: %q", b)
+			}
+		})
+	}
+}
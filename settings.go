@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Settings ------------------------
+// Экран /settings — inline-меню, которое перерисовывается на месте после
+// каждого переключения. Значения хранятся в User и проверяются хендлерами:
+// уведомления — в orderSubscribers, видимость контакта — в sendContactCard,
+// участие в поиске — в ListSearchableProfiles.
+
+const (
+	settingContact = "contact"
+	settingSearch  = "search"
+	settingNotify  = "notify:" // + категория
+)
+
+func init() {
+	callbacks.handle(callbackRoute{Name: "settings.toggle", Args: []cbArgKind{cbString}, Handler: onSettingsToggle})
+	callbacks.handle(callbackRoute{Name: "settings.lang", Handler: onSettingsLanguage})
+}
+
+func showSettings(b *Bot, chatID int64, lang string, u User) {
+	msg := tgbot.NewMessage(chatID, T(lang, "settings.title"))
+	msg.ReplyMarkup = settingsKeyboard(lang, u)
+	sendMessage(msg)
+}
+
+func settingsKeyboard(lang string, u User) tgbot.InlineKeyboardMarkup {
+	var rows [][]tgbot.InlineKeyboardButton
+	for _, cat := range categories {
+		label := T(lang, "settings.notify", categoryTitle(lang, cat), onOff(u.NotifiesAbout(cat)))
+		rows = append(rows, tgbot.NewInlineKeyboardRow(
+			tgbot.NewInlineKeyboardButtonData(label, callbacks.encode("settings.toggle", settingNotify+cat)),
+		))
+	}
+	contact := T(lang, "settings.contact_username")
+	if u.RelayOnly() {
+		contact = T(lang, "settings.contact_relay")
+	}
+	rows = append(rows,
+		tgbot.NewInlineKeyboardRow(
+			tgbot.NewInlineKeyboardButtonData(T(lang, "settings.language", T(lang, "lang.name")), callbacks.encode("settings.lang")),
+		),
+		tgbot.NewInlineKeyboardRow(
+			tgbot.NewInlineKeyboardButtonData(contact, callbacks.encode("settings.toggle", settingContact)),
+		),
+		tgbot.NewInlineKeyboardRow(
+			tgbot.NewInlineKeyboardButtonData(T(lang, "settings.search", onOff(!u.HiddenFromSearch)), callbacks.encode("settings.toggle", settingSearch)),
+		),
+	)
+	return tgbot.NewInlineKeyboardMarkup(rows...)
+}
+
+func onOff(v bool) string {
+	if v {
+		return "✅"
+	}
+	return "🚫"
+}
+
+// getUser возвращает сохранённого пользователя или, если его ещё нет, пользователя
+// с настройками по умолчанию. Ошибка означает сбой хранилища — такого пользователя
+// нельзя сохранять обратно, иначе настройки затрутся умолчаниями.
+func getUser(ctx context.Context, userID int64) (User, error) {
+	u, err := storage.GetUser(ctx, userID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return User{UserID: userID}, nil
+	case err != nil:
+		return User{}, err
+	}
+	return *u, nil
+}
+
+// loadUser — getUser для чтения настроек: при сбое хранилища действуют умолчания
+func loadUser(ctx context.Context, userID int64) User {
+	u, err := getUser(ctx, userID)
+	if err != nil {
+		return User{UserID: userID}
+	}
+	return u
+}
+
+func onSettingsToggle(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	lang := userLang(ctx, q.From)
+	u, err := getUser(ctx, q.From.ID)
+	if err != nil {
+		sendText(b, q.From.ID, T(lang, "error.generic"))
+		return
+	}
+	switch opt := args.String(0); {
+	case opt == settingContact:
+		if u.RelayOnly() {
+			u.ContactVisibility = contactUsername
+		} else {
+			u.ContactVisibility = contactRelay
+		}
+	case opt == settingSearch:
+		u.HiddenFromSearch = !u.HiddenFromSearch
+	case strings.HasPrefix(opt, settingNotify) && slices.Contains(categories, strings.TrimPrefix(opt, settingNotify)):
+		u.NotifyCategories = toggleCategory(u.NotifyCategories, strings.TrimPrefix(opt, settingNotify))
+	default:
+		logger(ctx).Warn("unknown setting", slog.String("option", opt))
+		return
+	}
+	if err := storage.SaveUser(ctx, u); err != nil {
+		sendText(b, q.From.ID, T(lang, "error.generic"))
+		return
+	}
+	if q.Message == nil {
+		showSettings(b, q.From.ID, lang, u)
+		return
+	}
+	sendMessage(tgbot.NewEditMessageReplyMarkup(q.Message.Chat.ID, q.Message.MessageID, settingsKeyboard(lang, u)))
+}
+
+func onSettingsLanguage(ctx context.Context, b *Bot, q *tgbot.CallbackQuery, args callbackArgs) {
+	lang := userLang(ctx, q.From)
+	showMenu(b, callbackChatID(q), lang, T(lang, "language.choose"), languageMenu())
+}
+
+func toggleCategory(cats []string, cat string) []string {
+	out := make([]string, 0, len(cats)+1)
+	found := false
+	for _, c := range cats {
+		if c == cat {
+			found = true
+			continue
+		}
+		out = append(out, c)
+	}
+	if !found {
+		out = append(out, cat)
+	}
+	return out
+}
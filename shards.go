@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ------------------------ Per-user shards ------------------------
+// Апдейты одного пользователя обрабатываются строго по очереди (иначе два
+// быстрых сообщения могут сломать мастер creating_order:), а разные
+// пользователи — параллельно. Диспетчер читает updatesChan и раскладывает
+// апдейты по очередям-шардам с ключом user ID (или chat ID). У каждого шарда
+// своя горутина; одновременно обрабатывается не больше UpdateWorkers апдейтов.
+// Диспетчер никогда не ждёт шард: апдейт в переполненный шард (один
+// пользователь шлёт быстрее, чем обрабатывается) отбрасывается и учитывается
+// в conectwork_shed_updates_total, а остальные пользователи не простаивают.
+// Общий backpressure — заполненный updatesChan, тогда вебхук отвечает 503.
+// Шард без апдейтов дольше shardIdleTimeout удаляется.
+
+const shardIdleTimeout = time.Minute
+
+type shard struct {
+	ch      chan *tgbot.Update
+	pending int // поставлено в шард, но ещё не обработано; под dispatcher.mu
+}
+
+type updateDispatcher struct {
+	mu        sync.Mutex
+	shards    map[int64]*shard
+	sem       chan struct{}
+	queueSize int
+	idle      time.Duration
+	wg        sync.WaitGroup
+	process   func(*tgbot.Update)
+}
+
+func newUpdateDispatcher(workers, queueSize int, process func(*tgbot.Update)) *updateDispatcher {
+	return &updateDispatcher{
+		shards:    map[int64]*shard{},
+		sem:       make(chan struct{}, workers),
+		queueSize: queueSize,
+		idle:      shardIdleTimeout,
+		process:   process,
+	}
+}
+
+// run раскладывает апдейты из in по шардам, пока in не закрыт,
+// затем закрывает шарды и ждёт, пока они разберут свои очереди
+func (d *updateDispatcher) run(in <-chan *tgbot.Update) {
+	for upd := range in {
+		d.dispatch(upd)
+	}
+	d.mu.Lock()
+	for key, s := range d.shards {
+		close(s.ch)
+		delete(d.shards, key)
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+func (d *updateDispatcher) dispatch(upd *tgbot.Update) {
+	key := updateKey(upd)
+	d.mu.Lock()
+	s, ok := d.shards[key]
+	if !ok {
+		s = &shard{ch: make(chan *tgbot.Update, d.queueSize)}
+		d.shards[key] = s
+		d.wg.Add(1)
+		go d.worker(key, s)
+	}
+	// отправка под mu: шард не может завершиться по простою, пока мы в него пишем
+	select {
+	case s.ch <- upd:
+		s.pending++
+		d.mu.Unlock()
+	default:
+		d.mu.Unlock()
+		shedUpdatesTotal.Inc()
+		slog.Warn("user shard full, update dropped", slog.Int64("key", key), slog.Int("update_id", upd.UpdateID))
+	}
+}
+
+func (d *updateDispatcher) worker(key int64, s *shard) {
+	defer d.wg.Done()
+	timer := time.NewTimer(d.idle)
+	defer timer.Stop()
+	for {
+		select {
+		case upd, ok := <-s.ch:
+			if !ok {
+				return
+			}
+			d.sem <- struct{}{}
+			d.process(upd)
+			<-d.sem
+			d.mu.Lock()
+			s.pending--
+			d.mu.Unlock()
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(d.idle)
+		case <-timer.C:
+			d.mu.Lock()
+			if s.pending == 0 {
+				delete(d.shards, key)
+				d.mu.Unlock()
+				return
+			}
+			d.mu.Unlock()
+			timer.Reset(d.idle)
+		}
+	}
+}
+
+// updateKey выбирает ключ упорядочивания: отправитель, иначе чат, иначе сам апдейт
+func updateKey(upd *tgbot.Update) int64 {
+	if from := upd.SentFrom(); from != nil {
+		return from.ID
+	}
+	switch {
+	case upd.MyChatMember != nil:
+		return upd.MyChatMember.From.ID
+	case upd.ChatMember != nil:
+		return upd.ChatMember.Chat.ID
+	case upd.CallbackQuery == nil:
+		// FromChat разыменовывает CallbackQuery.Message, поэтому только здесь
+		if chat := upd.FromChat(); chat != nil {
+			return chat.ID
+		}
+	}
+	return int64(upd.UpdateID)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tgbot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestDispatcherPerUserOrder(t *testing.T) {
+	const users, perUser = 5, 200
+	var (
+		mu      sync.Mutex
+		got     = map[int64][]int{}
+		running = map[int64]bool{}
+	)
+	// очередь шарда вмещает все апдейты пользователя, ничего не отбрасывается
+	d := newUpdateDispatcher(3, perUser, func(upd *tgbot.Update) {
+		key := updateKey(upd)
+		mu.Lock()
+		if running[key] {
+			t.Errorf("user %d: two updates processed at once", key)
+		}
+		running[key] = true
+		mu.Unlock()
+		time.Sleep(10 * time.Microsecond)
+		mu.Lock()
+		running[key] = false
+		got[key] = append(got[key], upd.UpdateID)
+		mu.Unlock()
+	})
+	// короткий простой, чтобы шарды удалялись и пересоздавались по ходу теста
+	d.idle = time.Millisecond
+
+	in := make(chan *tgbot.Update)
+	done := make(chan struct{})
+	go func() {
+		d.run(in)
+		close(done)
+	}()
+	id := 0
+	for i := 0; i < perUser; i++ {
+		for u := int64(1); u <= users; u++ {
+			id++
+			from := &tgbot.User{ID: u}
+			// сообщения и колбэки одного пользователя попадают в один шард
+			upd := &tgbot.Update{UpdateID: id, Message: &tgbot.Message{From: from, Chat: &tgbot.Chat{ID: u}}}
+			if i%3 == 0 {
+				upd = &tgbot.Update{UpdateID: id, CallbackQuery: &tgbot.CallbackQuery{From: from}}
+			}
+			in <- upd
+		}
+		if i%50 == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	close(in)
+	<-done
+
+	for u := int64(1); u <= users; u++ {
+		ids := got[u]
+		if len(ids) != perUser {
+			t.Fatalf("user %d: processed %d updates, want %d", u, len(ids), perUser)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] <= ids[i-1] {
+				t.Fatalf("user %d: update %d processed after %d", u, ids[i], ids[i-1])
+			}
+		}
+	}
+}
+
+func TestDispatcherUsersInParallel(t *testing.T) {
+	release := make(chan struct{})
+	processed := make(chan int64, 1)
+	d := newUpdateDispatcher(2, 4, func(upd *tgbot.Update) {
+		if upd.Message.From.ID == 1 {
+			<-release
+			return
+		}
+		processed <- upd.Message.From.ID
+	})
+	in := make(chan *tgbot.Update)
+	done := make(chan struct{})
+	go func() {
+		d.run(in)
+		close(done)
+	}()
+	msg := func(id int, user int64) *tgbot.Update {
+		return &tgbot.Update{UpdateID: id, Message: &tgbot.Message{From: &tgbot.User{ID: user}, Chat: &tgbot.Chat{ID: user}}}
+	}
+	in <- msg(1, 1)
+	in <- msg(2, 2)
+	// пользователь 1 завис в обработке, пользователь 2 не должен его ждать
+	select {
+	case u := <-processed:
+		if u != 2 {
+			t.Fatalf("processed user %d, want 2", u)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("user 2 blocked behind user 1")
+	}
+	close(release)
+	close(in)
+	<-done
+}
+
+func TestDispatcherFullShardDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	var mu sync.Mutex
+	processed := map[int64]int{}
+	d := newUpdateDispatcher(2, 2, func(upd *tgbot.Update) {
+		if upd.Message.From.ID == 1 {
+			started <- struct{}{}
+			<-release
+		}
+		mu.Lock()
+		processed[upd.Message.From.ID]++
+		mu.Unlock()
+	})
+	in := make(chan *tgbot.Update)
+	done := make(chan struct{})
+	go func() {
+		d.run(in)
+		close(done)
+	}()
+	msg := func(id int, user int64) *tgbot.Update {
+		return &tgbot.Update{UpdateID: id, Message: &tgbot.Message{From: &tgbot.User{ID: user}, Chat: &tgbot.Chat{ID: user}}}
+	}
+	in <- msg(1, 1)
+	<-started
+	// пользователь 1 завис и шлёт больше, чем помещается в его шард
+	for i := 2; i <= 10; i++ {
+		select {
+		case in <- msg(i, 1):
+		case <-time.After(time.Second):
+			t.Fatalf("dispatcher blocked on update %d of a full shard", i)
+		}
+	}
+	select {
+	case in <- msg(11, 2):
+	case <-time.After(time.Second):
+		t.Fatal("dispatcher blocked: user 2 cannot be dispatched")
+	}
+	close(release)
+	close(in)
+	<-done
+	// одно в обработке и два в очереди шарда, остальное отброшено
+	if processed[1] != 3 || processed[2] != 1 {
+		t.Fatalf("processed %v, want user 1: 3, user 2: 1", processed)
+	}
+}
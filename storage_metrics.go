@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// instrumentedStorage замеряет задержку каждого метода Storage
+// (метрика conectwork_storage_duration_seconds)
+type instrumentedStorage struct {
+	next Storage
+}
+
+func instrumentStorage(s Storage) Storage {
+	return instrumentedStorage{next: s}
+}
+
+// observe вызывается через defer; err читается уже после возврата метода
+func observe(method string, start time.Time, err *error) {
+	result := "ok"
+	if *err != nil {
+		result = "error"
+	}
+	storageDuration.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+}
+
+func (s instrumentedStorage) CreateOrUpdateProfile(ctx context.Context, p Profile) (err error) {
+	defer observe("CreateOrUpdateProfile", time.Now(), &err)
+	return s.next.CreateOrUpdateProfile(ctx, p)
+}
+
+func (s instrumentedStorage) GetProfile(ctx context.Context, userID int64) (_ *Profile, err error) {
+	defer observe("GetProfile", time.Now(), &err)
+	return s.next.GetProfile(ctx, userID)
+}
+
+func (s instrumentedStorage) DeleteProfile(ctx context.Context, userID int64) (err error) {
+	defer observe("DeleteProfile", time.Now(), &err)
+	return s.next.DeleteProfile(ctx, userID)
+}
+
+func (s instrumentedStorage) GetUser(ctx context.Context, userID int64) (_ *User, err error) {
+	defer observe("GetUser", time.Now(), &err)
+	return s.next.GetUser(ctx, userID)
+}
+
+func (s instrumentedStorage) SaveUser(ctx context.Context, u User) (err error) {
+	defer observe("SaveUser", time.Now(), &err)
+	return s.next.SaveUser(ctx, u)
+}
+
+func (s instrumentedStorage) SetUserBanned(ctx context.Context, userID int64, banned bool) (err error) {
+	defer observe("SetUserBanned", time.Now(), &err)
+	return s.next.SetUserBanned(ctx, userID, banned)
+}
+
+func (s instrumentedStorage) ListSubscribers(ctx context.Context, category string) (_ []int64, err error) {
+	defer observe("ListSubscribers", time.Now(), &err)
+	return s.next.ListSubscribers(ctx, category)
+}
+
+func (s instrumentedStorage) GetGroupChat(ctx context.Context, chatID int64) (_ *GroupChat, err error) {
+	defer observe("GetGroupChat", time.Now(), &err)
+	return s.next.GetGroupChat(ctx, chatID)
+}
+
+func (s instrumentedStorage) SaveGroupChat(ctx context.Context, g GroupChat) (err error) {
+	defer observe("SaveGroupChat", time.Now(), &err)
+	return s.next.SaveGroupChat(ctx, g)
+}
+
+func (s instrumentedStorage) SetGroupMember(ctx context.Context, chatID, userID int64, status string) (err error) {
+	defer observe("SetGroupMember", time.Now(), &err)
+	return s.next.SetGroupMember(ctx, chatID, userID, status)
+}
+
+func (s instrumentedStorage) ListSearchableProfiles(ctx context.Context, limit int) (_ []Profile, err error) {
+	defer observe("ListSearchableProfiles", time.Now(), &err)
+	return s.next.ListSearchableProfiles(ctx, limit)
+}
+
+func (s instrumentedStorage) CreateOrder(ctx context.Context, o Order, notices func(Order) []OutboxMessage) (_ int64, err error) {
+	defer observe("CreateOrder", time.Now(), &err)
+	return s.next.CreateOrder(ctx, o, notices)
+}
+
+func (s instrumentedStorage) GetOrderByCreator(ctx context.Context, userID int64) (_ *Order, err error) {
+	defer observe("GetOrderByCreator", time.Now(), &err)
+	return s.next.GetOrderByCreator(ctx, userID)
+}
+
+func (s instrumentedStorage) GetOrderByID(ctx context.Context, id int64) (_ *Order, err error) {
+	defer observe("GetOrderByID", time.Now(), &err)
+	return s.next.GetOrderByID(ctx, id)
+}
+
+func (s instrumentedStorage) DeleteOrderByID(ctx context.Context, id int64, notices ...OutboxMessage) (err error) {
+	defer observe("DeleteOrderByID", time.Now(), &err)
+	return s.next.DeleteOrderByID(ctx, id, notices...)
+}
+
+func (s instrumentedStorage) UpdateOrder(ctx context.Context, o Order) (err error) {
+	defer observe("UpdateOrder", time.Now(), &err)
+	return s.next.UpdateOrder(ctx, o)
+}
+
+func (s instrumentedStorage) IncrementComplaint(ctx context.Context, orderID int64, reporterID int64) (_ int, err error) {
+	defer observe("IncrementComplaint", time.Now(), &err)
+	return s.next.IncrementComplaint(ctx, orderID, reporterID)
+}
+
+func (s instrumentedStorage) ListOrdersByCategory(ctx context.Context, cat string) (_ []Order, err error) {
+	defer observe("ListOrdersByCategory", time.Now(), &err)
+	return s.next.ListOrdersByCategory(ctx, cat)
+}
+
+func (s instrumentedStorage) OrderStats(ctx context.Context) (_ []OrderStats, err error) {
+	defer observe("OrderStats", time.Now(), &err)
+	return s.next.OrderStats(ctx)
+}
+
+func (s instrumentedStorage) EnqueueOutbox(ctx context.Context, msgs ...OutboxMessage) (err error) {
+	defer observe("EnqueueOutbox", time.Now(), &err)
+	return s.next.EnqueueOutbox(ctx, msgs...)
+}
+
+func (s instrumentedStorage) ClaimOutbox(ctx context.Context, limit int, lease time.Duration) (_ []OutboxMessage, err error) {
+	defer observe("ClaimOutbox", time.Now(), &err)
+	return s.next.ClaimOutbox(ctx, limit, lease)
+}
+
+func (s instrumentedStorage) MarkOutboxSent(ctx context.Context, id int64) (err error) {
+	defer observe("MarkOutboxSent", time.Now(), &err)
+	return s.next.MarkOutboxSent(ctx, id)
+}
+
+func (s instrumentedStorage) MarkOutboxFailed(ctx context.Context, id int64, reason string) (err error) {
+	defer observe("MarkOutboxFailed", time.Now(), &err)
+	return s.next.MarkOutboxFailed(ctx, id, reason)
+}
+
+func (s instrumentedStorage) MarkUpdateSeen(ctx context.Context, updateID int) (_ bool, err error) {
+	defer observe("MarkUpdateSeen", time.Now(), &err)
+	return s.next.MarkUpdateSeen(ctx, updateID)
+}
+
+func (s instrumentedStorage) ForgetUpdate(ctx context.Context, updateID int) (err error) {
+	defer observe("ForgetUpdate", time.Now(), &err)
+	return s.next.ForgetUpdate(ctx, updateID)
+}
+
+func (s instrumentedStorage) PruneSeenUpdates(ctx context.Context, olderThan time.Duration) (err error) {
+	defer observe("PruneSeenUpdates", time.Now(), &err)
+	return s.next.PruneSeenUpdates(ctx, olderThan)
+}
+
+func (s instrumentedStorage) PruneOutbox(ctx context.Context, olderThan time.Duration) (err error) {
+	defer observe("PruneOutbox", time.Now(), &err)
+	return s.next.PruneOutbox(ctx, olderThan)
+}
+
+func (s instrumentedStorage) Ping(ctx context.Context) (err error) {
+	defer observe("Ping", time.Now(), &err)
+	return s.next.Ping(ctx)
+}
+
+func (s instrumentedStorage) Close() error {
+	return s.next.Close()
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// forEachStorage запускает тест на каждом хранилище с чистыми данными.
+// Postgres проверяется, только если задан TEST_DATABASE_URL: его таблицы очищаются.
+func forEachStorage(t *testing.T, fn func(t *testing.T, ctx context.Context)) {
+	backends := []struct {
+		name string
+		init func(t *testing.T) error
+	}{
+		{"json", func(t *testing.T) error {
+			return InitJSONStorage(filepath.Join(t.TempDir(), "storage.json"), 2, false)
+		}},
+		{"sqlite", func(t *testing.T) error {
+			return InitSQLite(filepath.Join(t.TempDir(), "bot.db"))
+		}},
+		{"postgres", func(t *testing.T) error {
+			url := os.Getenv("TEST_DATABASE_URL")
+			if url == "" {
+				t.Skip("TEST_DATABASE_URL is not set")
+			}
+			if err := InitPostgres(url); err != nil {
+				return err
+			}
+			_, err := pgpool.Exec(context.Background(), `TRUNCATE outbox, seen_updates, group_members, group_chats, orders, profiles, users RESTART IDENTITY`)
+			return err
+		}},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			if err := b.init(t); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if err := storage.Close(); err != nil {
+					t.Error(err)
+				}
+				if b.name == "postgres" {
+					pgpool.Close()
+				}
+			})
+			fn(t, context.Background())
+		})
+	}
+}
+
+func claimKeys(t *testing.T, ctx context.Context, lease time.Duration) []string {
+	t.Helper()
+	batch, err := storage.ClaimOutbox(ctx, 100, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, m := range batch {
+		keys = append(keys, m.DedupKey)
+	}
+	return keys
+}
+
+func TestOutboxDedupKey(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context) {
+		a := outboxText("a", 1, "first")
+		b := outboxText("b", 2, "second")
+		if err := storage.EnqueueOutbox(ctx, a, b, outboxText("a", 1, "duplicate in one batch")); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.EnqueueOutbox(ctx, outboxText("a", 1, "duplicate later")); err != nil {
+			t.Fatal(err)
+		}
+		batch, err := storage.ClaimOutbox(ctx, 100, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(batch) != 2 || batch[0].DedupKey != "a" || batch[0].Text != "first" || batch[1].DedupKey != "b" {
+			t.Fatalf("claimed %+v, want a (first) and b", batch)
+		}
+		// отправленное сообщение по-прежнему защищает свой ключ
+		if err := storage.MarkOutboxSent(ctx, batch[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.EnqueueOutbox(ctx, outboxText("a", 1, "after sent")); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.MarkOutboxSent(ctx, batch[1].ID); err != nil {
+			t.Fatal(err)
+		}
+		if keys := claimKeys(t, ctx, time.Minute); len(keys) != 0 {
+			t.Fatalf("claimed %v after re-enqueueing a sent key", keys)
+		}
+	})
+}
+
+func TestOutboxLeaseExpiry(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context) {
+		if err := storage.EnqueueOutbox(ctx, outboxText("k", 1, "x")); err != nil {
+			t.Fatal(err)
+		}
+		first, err := storage.ClaimOutbox(ctx, 10, time.Second)
+		if err != nil || len(first) != 1 || first[0].Attempts != 1 {
+			t.Fatalf("first claim = %+v, %v", first, err)
+		}
+		if keys := claimKeys(t, ctx, time.Second); len(keys) != 0 {
+			t.Fatalf("leased message claimed again: %v", keys)
+		}
+		// SQLite хранит время в секундах, поэтому ждём с запасом
+		time.Sleep(2100 * time.Millisecond)
+		again, err := storage.ClaimOutbox(ctx, 10, time.Minute)
+		if err != nil || len(again) != 1 || again[0].ID != first[0].ID || again[0].Attempts != 2 {
+			t.Fatalf("claim after lease expiry = %+v, %v", again, err)
+		}
+		if err := storage.MarkOutboxFailed(ctx, again[0].ID, "gave up"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2100 * time.Millisecond)
+		if keys := claimKeys(t, ctx, time.Minute); len(keys) != 0 {
+			t.Fatalf("failed message claimed again: %v", keys)
+		}
+	})
+}
+
+func TestPruneOutbox(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context) {
+		if err := storage.EnqueueOutbox(ctx, outboxText("sent", 1, "x"), outboxText("failed", 1, "x"), outboxText("pending", 1, "x")); err != nil {
+			t.Fatal(err)
+		}
+		batch, err := storage.ClaimOutbox(ctx, 2, time.Minute)
+		if err != nil || len(batch) != 2 {
+			t.Fatalf("claim = %+v, %v", batch, err)
+		}
+		if err := storage.MarkOutboxSent(ctx, batch[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.MarkOutboxFailed(ctx, batch[1].ID, "403"); err != nil {
+			t.Fatal(err)
+		}
+
+		// в пределах окна ключи отправленных ещё защищены от повтора
+		if err := storage.PruneOutbox(ctx, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.EnqueueOutbox(ctx, outboxText("sent", 1, "x")); err != nil {
+			t.Fatal(err)
+		}
+		if keys := claimKeys(t, ctx, time.Nanosecond); len(keys) != 1 || keys[0] != "pending" {
+			t.Fatalf("claimed %v, want only pending", keys)
+		}
+
+		// отрицательный возраст — граница в будущем: удаляется всё завершённое
+		if err := storage.PruneOutbox(ctx, -time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.EnqueueOutbox(ctx, outboxText("sent", 1, "again"), outboxText("failed", 1, "again")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(1100 * time.Millisecond) // аренда pending из прошлого claim
+		keys := claimKeys(t, ctx, time.Minute)
+		if len(keys) != 3 {
+			t.Fatalf("claimed %v, want pending kept and pruned keys accepted again", keys)
+		}
+	})
+}
+
+func TestJSONCompactionDropsOldOutbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	if err := InitJSONStorage(path, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	js := storage.(*JSONStorage)
+	ctx := context.Background()
+	if err := js.EnqueueOutbox(ctx, outboxText("old", 1, "x"), outboxText("new", 1, "x")); err != nil {
+		t.Fatal(err)
+	}
+	batch, _ := js.ClaimOutbox(ctx, 10, time.Minute)
+	for _, m := range batch {
+		if err := js.MarkOutboxSent(ctx, m.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	js.mu.Lock()
+	for id, m := range js.Data.Outbox {
+		if m.DedupKey == "old" {
+			m.SentAt = time.Now().Add(-outboxRetention - time.Hour)
+			js.Data.Outbox[id] = m
+		}
+	}
+	js.mu.Unlock()
+	if err := js.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InitJSONStorage(path, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	var keys []string
+	for _, m := range storage.(*JSONStorage).Data.Outbox {
+		keys = append(keys, m.DedupKey)
+	}
+	if len(keys) != 1 || keys[0] != "new" {
+		t.Fatalf("outbox after compaction: %v, want [new]", keys)
+	}
+}
+
+func TestSetUserBanned(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context) {
+		// бан пользователя, который ещё не писал боту
+		if err := storage.SetUserBanned(ctx, 1, true); err != nil {
+			t.Fatal(err)
+		}
+		// сохранение настроек со старым значением Banned не снимает бан
+		if err := storage.SaveUser(ctx, User{UserID: 1, Language: "en"}); err != nil {
+			t.Fatal(err)
+		}
+		u, err := storage.GetUser(ctx, 1)
+		if err != nil || !u.Banned || u.Language != "en" {
+			t.Fatalf("GetUser = %+v, %v; want banned with language en", u, err)
+		}
+		if err := storage.SetUserBanned(ctx, 1, false); err != nil {
+			t.Fatal(err)
+		}
+		if u, err := storage.GetUser(ctx, 1); err != nil || u.Banned || u.Language != "en" {
+			t.Fatalf("after unban GetUser = %+v, %v", u, err)
+		}
+	})
+}
+
+func TestOrdersByCategory(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context) {
+		var want []int64
+		for creator := int64(1); creator <= 3; creator++ {
+			id, err := storage.CreateOrder(ctx, Order{CreatorID: creator, Category: "design", Text: "x"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, id)
+		}
+		if _, err := storage.CreateOrder(ctx, Order{CreatorID: 4, Category: "content", Text: "x"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.CreateOrder(ctx, Order{CreatorID: 1, Category: "content", Text: "x"}, nil); !errors.Is(err, ErrActiveOrderExists) {
+			t.Fatalf("second active order: err = %v, want ErrActiveOrderExists", err)
+		}
+		if _, err := storage.CreateOrder(ctx, Order{CreatorID: 5, Category: "music", Text: "x"}, nil); !errors.Is(err, ErrInvalidCategory) {
+			t.Fatalf("unknown category: err = %v, want ErrInvalidCategory", err)
+		}
+		if err := storage.SetUserBanned(ctx, 6, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.CreateOrder(ctx, Order{CreatorID: 6, Category: "design", Text: "x"}, nil); !errors.Is(err, ErrBanned) {
+			t.Fatalf("banned creator: err = %v, want ErrBanned", err)
+		}
+		for i := 0; i < 5; i++ {
+			orders, err := storage.ListOrdersByCategory(ctx, "design")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, o := range orders {
+				got = append(got, o.ID)
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("design orders = %v, want %v in creation order", got, want)
+			}
+		}
+	})
+}
+
+func TestSearchableProfiles(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, ctx context.Context) {
+		for _, uid := range []int64{1, 2, 3, 4} {
+			if err := storage.CreateOrUpdateProfile(ctx, Profile{UserID: uid, Username: "u"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := storage.SaveUser(ctx, User{UserID: 3, HiddenFromSearch: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.SetUserBanned(ctx, 4, true); err != nil {
+			t.Fatal(err)
+		}
+		// SQLite хранит updated_at в секундах
+		time.Sleep(1100 * time.Millisecond)
+		if err := storage.CreateOrUpdateProfile(ctx, Profile{UserID: 1, Username: "updated"}); err != nil {
+			t.Fatal(err)
+		}
+		profiles, err := storage.ListSearchableProfiles(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, p := range profiles {
+			got = append(got, p.UserID)
+		}
+		// скрытые и заблокированные не видны, недавно обновлённые — первыми
+		if !slices.Equal(got, []int64{1, 2}) {
+			t.Fatalf("searchable profiles = %v, want [1 2]", got)
+		}
+		if profiles, err := storage.ListSearchableProfiles(ctx, 1); err != nil || len(profiles) != 1 || profiles[0].UserID != 1 {
+			t.Fatalf("limit 1: %+v, %v", profiles, err)
+		}
+	})
+}
+
+func TestInitSQLiteBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bot.db")
+	if err := os.WriteFile(path, []byte("not a database, just some bytes long enough to be read as a header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitSQLite(path); err == nil {
+		storage.Close()
+		t.Fatal("InitSQLite succeeded on a non-database file")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ------------------------ Webhook authentication ------------------------
+// Секрет в пути /webhook/<WEBHOOK_SECRET> попадает в логи доступа, поэтому
+// Telegram дополнительно получает secret_token в setWebhook и присылает его
+// в заголовке X-Telegram-Bot-Api-Secret-Token. Запросы без совпадающего
+// заголовка отклоняются. Опционально проверяется и адрес отправителя по
+// списку подсетей Telegram (WEBHOOK_ALLOWED_CIDRS).
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// telegramCIDRs — опубликованные подсети, из которых Telegram шлёт вебхуки
+const telegramCIDRs = "149.154.160.0/20,91.108.4.0/22"
+
+// webhookSecretToken возвращает WEBHOOK_SECRET_TOKEN или производный от WEBHOOK_SECRET
+// (Telegram допускает в токене только A-Z, a-z, 0-9, _ и -, hex подходит)
+func webhookSecretToken(cfg Config) string {
+	if cfg.WebhookSecretToken != "" {
+		return cfg.WebhookSecretToken
+	}
+	sum := sha256.Sum256([]byte("conectwork/webhook:" + cfg.WebhookSecret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseCIDRs разбирает список подсетей через запятую; "telegram" раскрывается в telegramCIDRs
+func parseCIDRs(list string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		switch s {
+		case "":
+			continue
+		case "telegram":
+			nets, _ := parseCIDRs(telegramCIDRs)
+			out = append(out, nets...)
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad CIDR %q: %w", s, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// webhookAuth пропускает к next только запросы с верным secret_token и,
+// если задан allowed, с адреса из разрешённых подсетей
+func webhookAuth(token string, allowed []*net.IPNet, trustProxy bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if len(allowed) > 0 {
+			ip := clientIP(r, trustProxy)
+			if !ipAllowed(ip, allowed) {
+				slog.Warn("webhook request from disallowed address", slog.Any("ip", ip))
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// clientIP берёт адрес соединения или, за доверенным прокси (Render и т.п.),
+// последний адрес из X-Forwarded-For — его добавил сам прокси
+func clientIP(r *http.Request, trustProxy bool) net.IP {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			return net.ParseIP(strings.TrimSpace(parts[len(parts)-1]))
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func ipAllowed(ip net.IP, allowed []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range allowed {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
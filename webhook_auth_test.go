@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookAuth(t *testing.T) {
+	allowed, err := parseCIDRs("149.154.160.0/20, 91.108.4.0/22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		allowed    bool // проверять подсети
+		trustProxy bool
+		token      string
+		remote     string
+		xff        string
+		want       int
+	}{
+		{"верный токен", false, false, "secret", "1.2.3.4:5", "", http.StatusOK},
+		{"без токена", false, false, "", "1.2.3.4:5", "", http.StatusUnauthorized},
+		{"чужой токен", false, false, "secreT", "1.2.3.4:5", "", http.StatusUnauthorized},
+		{"префикс токена", false, false, "secre", "1.2.3.4:5", "", http.StatusUnauthorized},
+		{"адрес Telegram", true, false, "secret", "149.154.167.50:443", "", http.StatusOK},
+		{"чужой адрес", true, false, "secret", "1.2.3.4:5", "", http.StatusForbidden},
+		{"токен проверяется раньше адреса", true, false, "", "1.2.3.4:5", "", http.StatusUnauthorized},
+		{"X-Forwarded-For без доверия к прокси", true, false, "secret", "10.0.0.1:5", "149.154.167.50", http.StatusForbidden},
+		{"X-Forwarded-For за прокси", true, true, "secret", "10.0.0.1:5", "1.2.3.4, 149.154.167.50", http.StatusOK},
+		{"подделанный первый адрес XFF", true, true, "secret", "10.0.0.1:5", "149.154.167.50, 1.2.3.4", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nets := allowed
+			if !tt.allowed {
+				nets = nil
+			}
+			h := webhookAuth("secret", nets, tt.trustProxy, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			r := httptest.NewRequest(http.MethodPost, "/webhook/x", nil)
+			r.RemoteAddr = tt.remote
+			if tt.token != "" {
+				r.Header.Set(secretTokenHeader, tt.token)
+			}
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			h(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	tests := []struct {
+		list    string
+		n       int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"10.0.0.0/8", 1, false},
+		{" 10.0.0.0/8 , ,192.168.0.0/16", 2, false},
+		{"telegram", 2, false},
+		{"10.0.0.0", 0, true},
+	}
+	for _, tt := range tests {
+		nets, err := parseCIDRs(tt.list)
+		if (err != nil) != tt.wantErr || len(nets) != tt.n {
+			t.Errorf("parseCIDRs(%q) = %d nets, err %v; want %d, err %v", tt.list, len(nets), err, tt.n, tt.wantErr)
+		}
+	}
+}